@@ -78,13 +78,18 @@ func (p *FileSystemProvider) Get(name string) ([]byte, error) {
 func (p *FileSystemProvider) List(name string) ([]string, error) {
 	path := filepath.Join(p.root, name)
 
-	infos, err := os.ReadDir(path)
-	if os.IsNotExist(err) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) || info != nil && !info.IsDir() {
 		return nil, nil
 	} else if err != nil {
 		return nil, err
 	}
 
+	infos, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
 	names := make([]string, 0, len(infos))
 	for _, info := range infos {
 		names = append(names, info.Name())
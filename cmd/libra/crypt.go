@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cloudlibraries/libra/hierarchy"
+	"github.com/spf13/pflag"
+)
+
+// configEncrypt encrypts the values of the sensitive keys of a YAML, JSON or TOML file.
+func configEncrypt(args []string) error {
+	flags := pflag.NewFlagSet("libra config encrypt", pflag.ContinueOnError)
+	keys := flags.StringSlice("keys", hierarchy.DefaultSensitiveKeys, "patterns of the keys to encrypt")
+
+	return rewriteFile(flags, args, "encrypt", false, func(name string, data, key []byte) ([]byte, error) {
+		return hierarchy.EncryptAsset(name, data, key, *keys...)
+	})
+}
+
+// configDecrypt decrypts the encrypted values of a YAML, JSON or TOML file, which only
+// its owner may read once written.
+func configDecrypt(args []string) error {
+	flags := pflag.NewFlagSet("libra config decrypt", pflag.ContinueOnError)
+
+	return rewriteFile(flags, args, "decrypt", true, hierarchy.DecryptAsset)
+}
+
+// rewriteFile parses the key flags and rewrites the file given in args with rewrite.
+// The files written are private, readable by their owner alone, if private is true.
+func rewriteFile(
+	flags *pflag.FlagSet, args []string, command string, private bool,
+	rewrite func(name string, data, key []byte) ([]byte, error),
+) error {
+	keyFile := flags.String("key-file", "", "file holding the data key, instead of $"+hierarchy.KeyEnv)
+	inPlace := flags.BoolP("in-place", "i", false, "rewrite the file instead of writing to stdout")
+	out := flags.StringP("out", "o", "", "file to write to, instead of stdout")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%w: libra config %s [flags] <file>", ErrUsage, command)
+	}
+
+	provider := hierarchy.EnvKey(hierarchy.KeyEnv)
+	if *keyFile != "" {
+		provider = hierarchy.FileKey(*keyFile)
+	}
+
+	key, err := provider.Key()
+	if err != nil {
+		return err
+	}
+
+	name := flags.Arg(0)
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	data, err = rewrite(name, data, key)
+	if err != nil {
+		return err
+	}
+
+	perm := os.FileMode(0o644)
+	if private {
+		perm = 0o600
+	}
+
+	if !*inPlace {
+		return writeOutput(*out, data, perm)
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	perm = info.Mode().Perm()
+	if private {
+		perm &= 0o600
+	}
+
+	return writeOutput(name, data, perm)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudlibraries/libra/hierarchy"
+)
+
+func TestConfigDecryptMode(t *testing.T) {
+	t.Setenv(hierarchy.KeyEnv, base64.StdEncoding.EncodeToString(make([]byte, 32)))
+
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "app.yaml")
+	encrypted := filepath.Join(dir, "app.enc.yaml")
+
+	if err := os.WriteFile(plain, []byte("db:\n  password: s3cret\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run([]string{"config", "encrypt", "-o", encrypted, plain}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode := info.Mode().Perm(); mode != 0o644 {
+		t.Errorf("libra config encrypt -o wrote mode %v, want %v", mode, os.FileMode(0o644))
+	}
+
+	decrypted := filepath.Join(dir, "out.yaml")
+	if err := os.WriteFile(decrypted, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, file string
+		args       []string
+	}{
+		{"out", decrypted, []string{"config", "decrypt", "-o", decrypted, encrypted}},
+		{"in place", encrypted, []string{"config", "decrypt", "-i", encrypted}},
+	}
+
+	for _, test := range tests {
+		file := test.file
+
+		t.Run(test.name, func(t *testing.T) {
+			if err := run(test.args); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(string(data), "s3cret") {
+				t.Errorf("libra config decrypt wrote\n%s\nwant the plaintext", data)
+			}
+
+			info, err := os.Stat(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if mode := info.Mode().Perm(); mode != 0o600 {
+				t.Errorf("libra config decrypt wrote mode %v, want %v", mode, os.FileMode(0o600))
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cloudlibraries/libra/assets"
+	"github.com/cloudlibraries/libra/hierarchy"
+	"github.com/spf13/pflag"
+)
+
+// configGen generates Go structs, and optionally a JSON Schema, from the settings of a bundle.
+func configGen(args []string) error {
+	flags := pflag.NewFlagSet("libra config gen", pflag.ContinueOnError)
+	pkg := flags.String("package", "config", "package of the generated code")
+	typeName := flags.String("type", "Config", "name of the root struct")
+	key := flags.String("key", "", "generate the subtree at key only")
+	out := flags.StringP("out", "o", "", "file to write the structs to, instead of stdout")
+	schema := flags.String("schema", "", "file to write a JSON Schema of the settings to")
+	profiles := flags.StringSlice("profiles", nil, "profiles to activate while loading")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%w: libra config gen [flags] <bundle>", ErrUsage)
+	}
+
+	settings, err := loadSettings(flags.Arg(0), *key, *profiles)
+	if err != nil {
+		return err
+	}
+
+	src, err := hierarchy.GenerateStructs(settings, *pkg, *typeName)
+	if err != nil {
+		return err
+	}
+
+	if err := writeOutput(*out, src, 0o644); err != nil {
+		return err
+	}
+
+	if *schema == "" {
+		return nil
+	}
+
+	data, err := hierarchy.GenerateSchema(settings)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(*schema, append(data, '\n'), 0o644)
+}
+
+// loadSettings loads the bundle dir and returns the resolved settings at key, keeping
+// the case of keys so that they make readable Go names.
+func loadSettings(dir, key string, profiles []string) (map[string]interface{}, error) {
+	assetMap, err := assets.New(assets.NewFileSystemProvider("")).GetBundle(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hierarchy.New(hierarchy.PreserveCase())
+	if len(profiles) > 0 {
+		h.SetProfiles(profiles...)
+	}
+
+	if err := h.LoadAssetMap(assetMap); err != nil {
+		return nil, err
+	}
+
+	if key != "" {
+		h = h.Sub(key)
+	}
+
+	return h.AllSettings(), nil
+}
+
+// writeOutput writes data to the file name, or to stdout if name is empty. The file is
+// created with perm, and an existing file is made no more readable than perm.
+func writeOutput(name string, data []byte, perm os.FileMode) error {
+	if name == "" {
+		_, err := os.Stdout.Write(data)
+
+		return err
+	}
+
+	if err := os.WriteFile(name, data, perm); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	if mode := info.Mode().Perm(); mode&^perm != 0 {
+		return os.Chmod(name, mode&perm)
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigGen(t *testing.T) {
+	bundle := t.TempDir()
+	for name, data := range map[string]string{
+		"app.yaml":      "Logger:\n  level: info\n  max-size: 10MB\n  flush-interval: 1s\n",
+		"app.prod.yaml": "Logger:\n  level: warn\n  prod-only: true\n",
+	} {
+		if err := os.WriteFile(filepath.Join(bundle, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "config.go")
+	schema := filepath.Join(t.TempDir(), "config.schema.json")
+
+	if err := run([]string{"config", "gen", "--package", "settings", "-o", out, "--schema", schema, bundle}); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"package settings",
+		"Logger Logger `libra:\"Logger\" mapstructure:\"Logger\"`",
+		"MaxSize       hierarchy.ByteSize `libra:\"max-size\" mapstructure:\"max-size\"`",
+		"FlushInterval time.Duration",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("libra config gen wrote\n%s\nwant it to contain %q", src, want)
+		}
+	}
+
+	// Inactive profiles are left out.
+	if strings.Contains(string(src), "prod-only") {
+		t.Errorf("libra config gen wrote\n%s\nwith the prod profile inactive", src)
+	}
+
+	data, err := os.ReadFile(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !json.Valid(data) {
+		t.Errorf("libra config gen wrote an invalid schema:\n%s", data)
+	}
+
+	if err := run([]string{"config", "gen", "--key", "logger", "--profiles", "prod", "-o", out, bundle}); err != nil {
+		t.Fatal(err)
+	}
+
+	if src, _ := os.ReadFile(out); !strings.Contains(string(src), "ProdOnly") || strings.Contains(string(src), "Logger") {
+		t.Errorf("libra config gen --key logger --profiles prod wrote\n%s", src)
+	}
+
+	if err := run([]string{"config", "gen"}); !errors.Is(err, ErrUsage) {
+		t.Errorf("libra config gen without a bundle error = %v, want %v", err, ErrUsage)
+	}
+}
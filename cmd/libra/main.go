@@ -0,0 +1,38 @@
+// Command libra works with the configuration bundles read by the hierarchy package.
+//
+//	libra config gen [flags] <bundle>
+//	libra config encrypt [flags] <file>
+//	libra config decrypt [flags] <file>
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrUsage = errors.New("usage: libra config <gen|encrypt|decrypt> [flags]")
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "libra:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) < 2 || args[0] != "config" {
+		return ErrUsage
+	}
+
+	switch args[1] {
+	case "gen":
+		return configGen(args[2:])
+	case "encrypt":
+		return configEncrypt(args[2:])
+	case "decrypt":
+		return configDecrypt(args[2:])
+	default:
+		return fmt.Errorf("%w: unknown command %q", ErrUsage, args[1])
+	}
+}
@@ -22,6 +22,9 @@ func main() {
 		panic(err)
 	}
 
+	// TELEGRAM_TOKEN, or /run/secrets/telegram_token, overrides the placeholder token.
+	hierarchy.RegisterSecretBackend("example", hierarchy.DirSecrets(filepath.Join(projectDir, "examples", "logger", "secrets")))
+
 	h := hierarchy.New()
 	h.Set("ProjectDir", filepath.ToSlash(projectDir))
 
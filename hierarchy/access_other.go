@@ -0,0 +1,12 @@
+//go:build !unix
+
+package hierarchy
+
+import "os"
+
+// canWrite reports whether the file or directory at path is writable, from its mode only.
+func canWrite(path string, _ bool) bool {
+	info, err := os.Stat(path)
+
+	return err == nil && info.Mode().Perm()&0o200 != 0
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package hierarchy
+
+import "golang.org/x/sys/unix"
+
+// canWrite reports whether the process may write to the file at path, or create files in
+// the directory at path.
+func canWrite(path string, dir bool) bool {
+	mode := uint32(unix.W_OK)
+	if dir {
+		mode |= unix.X_OK
+	}
+
+	return unix.Access(path, mode) == nil
+}
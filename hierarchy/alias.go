@@ -0,0 +1,84 @@
+package hierarchy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+var ErrCircularAlias = errors.New("circular alias")
+
+func RegisterAlias(alias, key string) {
+	_default.RegisterAlias(alias, key)
+}
+
+// RegisterAlias makes alias another name of key: reads and writes of alias go to key.
+// Values already set at alias, by defaults, config or Set, are moved to key. A circular
+// alias is logged and ignored.
+func (h *Hierarchy) RegisterAlias(alias, key string) {
+	if h.root != nil {
+		h.root.RegisterAlias(h.absolute(alias), h.absolute(key))
+
+		return
+	}
+
+	alias, key = strings.Join(splitKey(alias), "."), strings.Join(splitKey(key), ".")
+
+	err := h.update(func(l *layers) error {
+		if alias == key || l.realKey(key) == alias {
+			return fmt.Errorf("%w: %s -> %s", ErrCircularAlias, alias, key)
+		}
+
+		if _, ok := l.aliases[alias]; ok {
+			return nil
+		}
+
+		aliasPath, keyPath := splitKey(alias), splitKey(key)
+
+		for _, layer := range []map[string]interface{}{l.defaults, l.config, l.override} {
+			if value, ok := lookupPath(layer, aliasPath); ok {
+				deletePath(layer, aliasPath)
+				setPath(layer, keyPath, value)
+			}
+		}
+
+		if origins, ok := l.origins[alias]; ok {
+			delete(l.origins, alias)
+			l.origins[key] = append(l.origins[key][:len(l.origins[key]):len(l.origins[key])], origins...)
+		}
+
+		l.aliases[alias] = key
+
+		return nil
+	})
+	if err != nil {
+		log.Printf("hierarchy: %v", err)
+	}
+}
+
+// realKey returns key, or the key it is an alias of, see RegisterAlias.
+func (l *layers) realKey(key string) string {
+	for {
+		target, ok := l.aliases[strings.Join(splitKey(key), ".")]
+		if !ok {
+			return key
+		}
+
+		key = target
+	}
+}
+
+// deletePath removes the value at path from the maps of m.
+func deletePath(m map[string]interface{}, path []string) {
+	for _, segment := range path[:len(path)-1] {
+		child, ok := m[segment].(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		m = child
+	}
+
+	delete(m, path[len(path)-1])
+}
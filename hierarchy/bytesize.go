@@ -0,0 +1,107 @@
+package hierarchy
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var ErrInvalidByteSize = errors.New("invalid byte size")
+
+// ByteSize is a size in bytes, decoded from values like 512, "64KB" or "1.5GiB".
+type ByteSize uint64
+
+// Byte size units, all based on 1024 as viper's GetSizeInBytes does.
+const (
+	B  ByteSize = 1
+	KB          = B << 10
+	MB          = KB << 10
+	GB          = MB << 10
+	TB          = GB << 10
+	PB          = TB << 10
+)
+
+var byteSizeUnits = map[string]ByteSize{
+	"":    B,
+	"b":   B,
+	"k":   KB,
+	"kb":  KB,
+	"kib": KB,
+	"m":   MB,
+	"mb":  MB,
+	"mib": MB,
+	"g":   GB,
+	"gb":  GB,
+	"gib": GB,
+	"t":   TB,
+	"tb":  TB,
+	"tib": TB,
+	"p":   PB,
+	"pb":  PB,
+	"pib": PB,
+}
+
+// ParseByteSize parses a byte size such as "10MB" or "1.5 GiB".
+func ParseByteSize(s string) (ByteSize, error) {
+	str := strings.TrimSpace(s)
+
+	index := strings.IndexFunc(str, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if index < 0 {
+		index = len(str)
+	}
+
+	number, unit := str[:index], strings.ToLower(strings.TrimSpace(str[index:]))
+	if number == "" {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidByteSize, s)
+	}
+
+	multiplier, ok := byteSizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidByteSize, s)
+	}
+
+	if n, err := strconv.ParseUint(number, 10, 64); err == nil {
+		return ByteSize(n) * multiplier, nil
+	}
+
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidByteSize, s)
+	}
+
+	return ByteSize(f * float64(multiplier)), nil
+}
+
+func (b ByteSize) String() string {
+	units := []struct {
+		size ByteSize
+		name string
+	}{{PB, "PB"}, {TB, "TB"}, {GB, "GB"}, {MB, "MB"}, {KB, "KB"}}
+
+	for _, unit := range units {
+		if b >= unit.size && b%unit.size == 0 {
+			return fmt.Sprintf("%d%s", b/unit.size, unit.name)
+		}
+	}
+
+	return fmt.Sprintf("%dB", uint64(b))
+}
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	size, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+
+	*b = size
+
+	return nil
+}
+
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,99 @@
+package hierarchy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PreserveCase keeps the case of keys as they were first set or loaded with an uppercase
+// letter, in AllSettings, Get, JSON, String and Unmarshal. Lookups stay case-insensitive.
+// Keys are recorded from YAML, JSON, TOML and protobuf assets, Set, SetDefault and
+// MergeConfigMap.
+func PreserveCase() Option {
+	return func(h *Hierarchy) {
+		h.preserveCase = true
+	}
+}
+
+// recordCase records key, the last key of path, if it has uppercase and path is new: the
+// case of a key set before this write, see clone, stays as it was first set.
+func (l *layers) recordCase(path, key string) {
+	if key == strings.ToLower(key) {
+		return
+	}
+
+	if _, ok := l.cases[path]; ok {
+		return
+	}
+
+	if _, ok := lookupPath(l.tree, strings.Split(path, ".")); ok {
+		return
+	}
+
+	l.cases[path] = key
+}
+
+// recordKeyCase records the case of the segments of key.
+func (l *layers) recordKeyCase(key string) {
+	path := ""
+
+	for _, segment := range splitPath(key) {
+		path = joinPath(path, strings.ToLower(segment))
+		l.recordCase(path, segment)
+	}
+}
+
+// recordCases records the case of the keys of value, set at path.
+func (l *layers) recordCases(path string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			childPath := joinPath(path, strings.ToLower(key))
+			l.recordCase(childPath, key)
+			l.recordCases(childPath, child)
+		}
+	case []interface{}:
+		for index, child := range v {
+			l.recordCases(joinPath(path, fmt.Sprint(index)), child)
+		}
+	default:
+		if m, ok := toStringMap(value); ok {
+			l.recordCases(path, m)
+		}
+	}
+}
+
+// cased returns value, read at path, with the case of its keys restored if h preserves case.
+func (h *Hierarchy) cased(l *layers, path string, value interface{}) interface{} {
+	if !h.preserveCase {
+		return value
+	}
+
+	return restoreCase(l.cases, path, value)
+}
+
+func restoreCase(cases map[string]string, path string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			childPath := joinPath(path, key)
+			if original, ok := cases[childPath]; ok {
+				key = original
+			}
+
+			m[key] = restoreCase(cases, childPath, child)
+		}
+
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for index, child := range v {
+			items[index] = restoreCase(cases, joinPath(path, fmt.Sprint(index)), child)
+		}
+
+		return items
+	default:
+		return value
+	}
+}
@@ -0,0 +1,84 @@
+package hierarchy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPreserveAssetCase(t *testing.T) {
+	tests := []struct {
+		name  string
+		asset string
+		want  map[string]interface{}
+	}{
+		{
+			name:  "app.json",
+			asset: `{"Headers": {"X-Request-Id": "1"}, "hooks": [{"Type": "file"}]}`,
+			want: map[string]interface{}{
+				"Headers": map[string]interface{}{"X-Request-Id": "1"},
+				"hooks":   []interface{}{map[string]interface{}{"Type": "file"}},
+			},
+		},
+		{
+			name:  "app.toml",
+			asset: "[Labels]\nAppName = \"api\"\n",
+			want:  map[string]interface{}{"Labels": map[string]interface{}{"AppName": "api"}},
+		},
+		{
+			name:  "app.yaml",
+			asset: "Labels: {AppName: api}\n",
+			want:  map[string]interface{}{"Labels": map[string]interface{}{"AppName": "api"}},
+		},
+		{
+			name:  "app.textproto",
+			asset: `fields { key: "AppName" value { string_value: "api" } }`,
+			want:  map[string]interface{}{"AppName": "api"},
+		},
+	}
+
+	for _, test := range tests {
+		h := New(PreserveCase())
+		if err := h.LoadAssetMap(map[string][]byte{test.name: []byte(test.asset)}); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if got := h.AllSettings(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: AllSettings() = %#v, want %#v", test.name, got, test.want)
+		}
+	}
+
+	h := New()
+	if err := h.LoadAssetMap(map[string][]byte{"app.json": []byte(`{"Headers": {"X-Request-Id": "1"}}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := h.GetString("headers.x-request-id"); got != "1" {
+		t.Errorf("headers.x-request-id = %q, want lookups to ignore case", got)
+	}
+}
+
+func TestPreserveFirstCase(t *testing.T) {
+	h := New(PreserveCase())
+	if err := h.LoadAssetMap(map[string][]byte{
+		"app.yaml": []byte("Headers: {X-Request-Id: '1'}\nlevel: info\n"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Set("HEADERS.x-new", "2")
+	h.Set("LEVEL", "warn")
+	h.Set("Labels.AppName", "api")
+
+	want := map[string]interface{}{
+		"Headers": map[string]interface{}{"X-Request-Id": "1", "x-new": "2"},
+		"level":   "warn",
+		"Labels":  map[string]interface{}{"AppName": "api"},
+	}
+	if got := h.AllSettings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AllSettings() = %#v, want %#v", got, want)
+	}
+
+	if got := h.Query("Headers.X-Request-Id").String(); got != "1" {
+		t.Errorf("Query(Headers.X-Request-Id) = %q, want 1", got)
+	}
+}
@@ -0,0 +1,163 @@
+package hierarchy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// versionAsset returns an asset of n keys whose values all hold version, and a reference
+// to one of them.
+func versionAsset(n, version int) map[string][]byte {
+	var buf strings.Builder
+
+	fmt.Fprintf(&buf, "version: %d\ncopy: ${version}\nkeys:\n", version)
+
+	for index := 0; index < n; index++ {
+		fmt.Fprintf(&buf, "  key%d: v%d\n", index, version)
+	}
+
+	return map[string][]byte{"app.yaml": []byte(buf.String())}
+}
+
+func TestConcurrentReads(t *testing.T) {
+	h := New()
+	if err := h.LoadAssetMap(versionAsset(10, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := h.Sub("keys")
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	for reader := 0; reader < 4; reader++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				settings := h.AllSettings()
+				version := fmt.Sprint(settings["version"])
+
+				// A read sees one version of every key, never a mix of two.
+				if copied := fmt.Sprint(settings["copy"]); copied != version {
+					t.Errorf("copy = %s, version = %s", copied, version)
+
+					return
+				}
+
+				keys, _ := settings["keys"].(map[string]interface{})
+				if got := fmt.Sprint(keys["key9"]); got != "v"+version {
+					t.Errorf("keys.key9 = %s, version = %s", got, version)
+
+					return
+				}
+
+				_ = h.GetString("keys.key0")
+				_ = sub.GetString("key1")
+				_ = h.IsSet("copy")
+			}
+		}()
+	}
+
+	for version := 1; version <= 100; version++ {
+		if err := h.LoadAssetMap(versionAsset(10, version)); err != nil {
+			t.Error(err)
+		}
+
+		h.Set("keys.key0", version)
+	}
+
+	close(done)
+	wg.Wait()
+
+	if got := h.GetInt("version"); got != 100 {
+		t.Errorf("version = %d, want 100", got)
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	h := New()
+
+	var wg sync.WaitGroup
+
+	for writer := 0; writer < 8; writer++ {
+		wg.Add(1)
+
+		go func(writer int) {
+			defer wg.Done()
+
+			for index := 0; index < 50; index++ {
+				h.Set(fmt.Sprintf("writer%d.key%d", writer, index), index)
+				_ = h.Get(fmt.Sprintf("writer%d", writer))
+			}
+		}(writer)
+	}
+
+	wg.Wait()
+
+	if keys := h.AllKeys(); len(keys) != 8*50 {
+		t.Errorf("%d keys, want %d", len(keys), 8*50)
+	}
+}
+
+func BenchmarkGetString(b *testing.B) {
+	h := New()
+	if err := h.LoadAssetMap(versionAsset(1000, 0)); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = h.GetString("keys.key500")
+	}
+}
+
+func BenchmarkGetStringDuringReloads(b *testing.B) {
+	h := New()
+	if err := h.LoadAssetMap(versionAsset(1000, 0)); err != nil {
+		b.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	reloaded := make(chan struct{})
+
+	go func() {
+		defer close(reloaded)
+
+		for version := 1; ; version++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			if err := h.LoadAssetMap(versionAsset(1000, version)); err != nil {
+				b.Error(err)
+
+				return
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = h.GetString("keys.key500")
+		}
+	})
+	b.StopTimer()
+
+	close(done)
+	<-reloaded
+}
@@ -0,0 +1,143 @@
+package hierarchy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// constraintTag holds the constraints checked on the structs filled by Unmarshal,
+// UnmarshalKey and Decode, e.g. `validate:"min=1,oneof=text json"`. See
+// github.com/go-playground/validator for the rules, including cross-field ones.
+const constraintTag = "validate"
+
+// squashedField names embedded fields whose keys are at the level of their parent.
+const squashedField = "^"
+
+var constraints = newConstraints()
+
+func newConstraints() *validator.Validate {
+	v := validator.New()
+	v.SetTagName(constraintTag)
+	v.RegisterTagNameFunc(fieldKey)
+
+	if err := v.RegisterValidation("writable", isWritable); err != nil {
+		panic(err)
+	}
+
+	return v
+}
+
+// RegisterValidation registers a custom constraint tag. Like other registrations,
+// it must happen before any concurrent Unmarshal, typically in an init function.
+func RegisterValidation(tag string, fn validator.Func) error {
+	return constraints.RegisterValidation(tag, fn)
+}
+
+// RegisterStructValidation registers a constraint over several fields of the types of
+// the given values, reporting violations with StructLevel.ReportError.
+func RegisterStructValidation(fn validator.StructLevelFunc, types ...interface{}) {
+	constraints.RegisterStructValidation(fn, types...)
+}
+
+// fieldKey returns the key a field is read from, so that violations name keys.
+func fieldKey(field reflect.StructField) string {
+	tag := parseFieldTag(field)
+	if _, ok := field.Tag.Lookup(tagName); !ok {
+		if name, ok := field.Tag.Lookup("mapstructure"); ok {
+			parts := strings.Split(name, ",")
+			tag.name = parts[0]
+
+			for _, part := range parts[1:] {
+				tag.squash = tag.squash || part == "squash"
+			}
+		}
+	}
+
+	switch {
+	case tag.skip:
+		return "-"
+	case tag.squash:
+		return squashedField
+	case tag.name == "":
+		return strings.ToLower(field.Name)
+	default:
+		return strings.ToLower(tag.name)
+	}
+}
+
+// isWritable checks that a file path can be written, or created in an existing directory,
+// from the permissions of the process, without writing anything.
+func isWritable(fl validator.FieldLevel) bool {
+	name := fl.Field().String()
+	if name == "" {
+		return false
+	}
+
+	info, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		dir, err := os.Stat(filepath.Dir(name))
+
+		return err == nil && dir.IsDir() && canWrite(filepath.Dir(name), true)
+	}
+
+	return err == nil && !info.IsDir() && canWrite(name, false)
+}
+
+// checkConstraints checks the constraints of v, decoded from key, if it is a struct.
+// The values of sensitive keys are masked in the violations.
+func (h *Hierarchy) checkConstraints(key string, v interface{}) error {
+	if indirectType(reflect.TypeOf(v)).Kind() != reflect.Struct {
+		return nil
+	}
+
+	err := constraints.Struct(v)
+
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return err
+	}
+
+	violations := make([]Violation, 0, len(fieldErrs))
+	s := h.base().sensitivity()
+
+	for _, fieldErr := range fieldErrs {
+		rule := fieldErr.Tag()
+		if fieldErr.Param() != "" {
+			rule += "=" + fieldErr.Param()
+		}
+
+		violationKey := namespaceKey(key, fieldErr.Namespace())
+
+		value := fieldErr.Value()
+		if s.matches(splitKey(h.absolute(violationKey))) {
+			value = secretMask
+		}
+
+		violations = append(violations, Violation{
+			Key:     violationKey,
+			Message: fmt.Sprintf("%v does not satisfy %s", value, rule),
+		})
+	}
+
+	return &ValidationError{Violations: violations}
+}
+
+// namespaceKey converts a validator namespace such as `Config.hooks[0].size` into a key.
+func namespaceKey(key, namespace string) string {
+	// The namespace starts with the name of the struct type, which may be empty.
+	namespace = namespace[strings.IndexByte(namespace, '.')+1:]
+
+	for _, segment := range splitPath(namespace) {
+		if segment != squashedField {
+			key = joinPath(key, segment)
+		}
+	}
+
+	return key
+}
@@ -0,0 +1,70 @@
+package hierarchy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type dbConfig struct {
+	User     string `validate:"min=8"`
+	Password string `validate:"min=8"`
+	Log      string `validate:"writable"`
+}
+
+func TestConstraintsRedact(t *testing.T) {
+	h := New()
+	h.Set("db.user", "admin")
+	h.Set("db.password", "hunter2")
+
+	var config dbConfig
+
+	err := h.UnmarshalKey("db", &config)
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("UnmarshalKey error = %v, want a ValidationError", err)
+	}
+
+	if s := err.Error(); strings.Contains(s, "hunter2") || !strings.Contains(s, "admin") {
+		t.Errorf("UnmarshalKey error = %s, want the password masked and the user shown", s)
+	}
+}
+
+func TestWritable(t *testing.T) {
+	dir := t.TempDir()
+
+	readOnly := filepath.Join(dir, "read-only.log")
+	if err := os.WriteFile(readOnly, nil, 0o400); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file string
+		want bool
+	}{
+		{file: filepath.Join(dir, "new.log"), want: true},
+		{file: filepath.Join(dir, "missing", "new.log")},
+		{file: dir},
+		{file: readOnly, want: os.Geteuid() == 0},
+	}
+
+	for _, test := range tests {
+		h := New()
+		h.Set("user", "administrator")
+		h.Set("password", "correct horse")
+		h.Set("log", test.file)
+
+		var config dbConfig
+		if err := h.Unmarshal(&config); (err == nil) != test.want {
+			t.Errorf("Unmarshal with log %s error = %v, want writable %v", test.file, err, test.want)
+		}
+	}
+
+	// Checking does not create files.
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%s holds %d files after the checks, want 1", dir, len(entries))
+	}
+}
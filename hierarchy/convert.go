@@ -0,0 +1,247 @@
+package hierarchy
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported type")
+	ErrConvertFailed   = errors.New("failed to convert")
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	byteSizeType        = reflect.TypeOf(ByteSize(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// isScalarType reports whether t is decoded from a single value rather than a map or a slice.
+func isScalarType(t reflect.Type) bool {
+	switch t {
+	case durationType, timeType, byteSizeType:
+		return true
+	}
+
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.Ptr, reflect.Interface:
+		return false
+	default:
+		return true
+	}
+}
+
+// convertScalar converts in to a value of type t, failing instead of falling back to zero.
+func convertScalar(in interface{}, t reflect.Type) (reflect.Value, error) {
+	v, err := convertScalarValue(in, t)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("%w: %#v to %s: %v", ErrConvertFailed, in, t, err)
+	}
+
+	return v, nil
+}
+
+func convertScalarValue(in interface{}, t reflect.Type) (reflect.Value, error) {
+	switch t {
+	case durationType:
+		d, err := cast.ToDurationE(in)
+		return reflect.ValueOf(d), err
+	case timeType:
+		tm, err := cast.ToTimeE(in)
+		return reflect.ValueOf(tm), err
+	case byteSizeType:
+		if s, ok := in.(string); ok {
+			size, err := ParseByteSize(s)
+			return reflect.ValueOf(size), err
+		}
+
+		n, err := cast.ToUint64E(in)
+
+		return reflect.ValueOf(ByteSize(n)), err
+	}
+
+	if s, ok := in.(string); ok && reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		v := reflect.New(t)
+		if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return reflect.Value{}, err
+		}
+
+		return v.Elem(), nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		s, err := cast.ToStringE(in)
+		return reflect.ValueOf(s).Convert(t), err
+	case reflect.Bool:
+		b, err := toBool(in)
+		return reflect.ValueOf(b).Convert(t), err
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := toInt64(in)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		v := reflect.New(t).Elem()
+		if v.OverflowInt(n) {
+			return reflect.Value{}, fmt.Errorf("%d overflows %s", n, t)
+		}
+
+		v.SetInt(n)
+
+		return v, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := toUint64(in)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		v := reflect.New(t).Elem()
+		if v.OverflowUint(n) {
+			return reflect.Value{}, fmt.Errorf("%d overflows %s", n, t)
+		}
+
+		v.SetUint(n)
+
+		return v, nil
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat64(in)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		v := reflect.New(t).Elem()
+		if v.OverflowFloat(f) {
+			return reflect.Value{}, fmt.Errorf("%g overflows %s", f, t)
+		}
+
+		v.SetFloat(f)
+
+		return v, nil
+	default:
+		return reflect.Value{}, fmt.Errorf("%w: %s", ErrUnsupportedType, t)
+	}
+}
+
+// decimalExp matches the integers parsed from strings: decimal, without leading zeros
+// that would read as octal elsewhere.
+var decimalExp = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)$`)
+
+// toBool converts booleans, the strings strconv.ParseBool accepts, and the integers 0 and 1.
+func toBool(in interface{}) (bool, error) {
+	switch v := in.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(strings.TrimSpace(v))
+	}
+
+	if n, err := toInt64(in); err == nil && (n == 0 || n == 1) {
+		return n == 1, nil
+	}
+
+	return false, fmt.Errorf("%#v is not a boolean", in)
+}
+
+// toInt64 converts integers, whole floats and decimal strings, rejecting anything lossy.
+func toInt64(in interface{}) (int64, error) {
+	switch v := reflect.ValueOf(in); v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows int64", v.Uint())
+		}
+
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, fmt.Errorf("%v is not an integer", f)
+		}
+
+		return int64(f), nil
+	case reflect.String:
+		s := strings.TrimSpace(v.String())
+		if !decimalExp.MatchString(s) {
+			return 0, fmt.Errorf("%q is not a decimal integer", s)
+		}
+
+		return strconv.ParseInt(s, 10, 64)
+	default:
+		return 0, fmt.Errorf("%#v is not an integer", in)
+	}
+}
+
+// toUint64 is like toInt64 for unsigned integers, rejecting negative values.
+func toUint64(in interface{}) (uint64, error) {
+	switch v := reflect.ValueOf(in); v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+			return 0, fmt.Errorf("%v is not an unsigned integer", f)
+		}
+
+		return uint64(f), nil
+	case reflect.String:
+		s := strings.TrimPrefix(strings.TrimSpace(v.String()), "+")
+		if !decimalExp.MatchString(s) || strings.HasPrefix(s, "-") {
+			return 0, fmt.Errorf("%q is not a decimal unsigned integer", s)
+		}
+
+		return strconv.ParseUint(s, 10, 64)
+	}
+
+	n, err := toInt64(in)
+	if err != nil {
+		return 0, err
+	} else if n < 0 {
+		return 0, fmt.Errorf("%d is negative", n)
+	}
+
+	return uint64(n), nil
+}
+
+// toFloat64 converts numbers and numeric strings, rejecting integers a float64 cannot hold exactly.
+func toFloat64(in interface{}) (float64, error) {
+	switch v := reflect.ValueOf(in); v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return strconv.ParseFloat(strings.TrimSpace(v.String()), 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if f := float64(v.Uint()); f < math.MaxUint64 && uint64(f) == v.Uint() {
+			return f, nil
+		}
+
+		return 0, fmt.Errorf("%d cannot be represented as a float", v.Uint())
+	}
+
+	n, err := toInt64(in)
+	if err != nil {
+		return 0, fmt.Errorf("%#v is not a number", in)
+	}
+
+	if f := float64(n); f < math.MaxInt64 && int64(f) == n {
+		return f, nil
+	}
+
+	return 0, fmt.Errorf("%d cannot be represented as a float", n)
+}
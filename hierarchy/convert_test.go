@@ -0,0 +1,193 @@
+package hierarchy
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConvertScalar(t *testing.T) {
+	tests := []struct {
+		in      interface{}
+		to      interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{in: 42, to: int(0), want: 42},
+		{in: "42", to: int(0), want: 42},
+		{in: " -7 ", to: int(0), want: -7},
+		{in: 3.0, to: int(0), want: 3},
+		{in: 1.5, to: int(0), wantErr: true},
+		{in: "010", to: int(0), wantErr: true},
+		{in: "0x10", to: int(0), wantErr: true},
+		{in: "1e3", to: int(0), wantErr: true},
+		{in: true, to: int(0), wantErr: true},
+		{in: 300, to: int8(0), wantErr: true},
+		{in: uint64(math.MaxUint64), to: int64(0), wantErr: true},
+		{in: uint64(math.MaxUint64), to: uint64(0), want: uint64(math.MaxUint64)},
+		{in: "18446744073709551615", to: uint64(0), want: uint64(math.MaxUint64)},
+		{in: -1, to: uint(0), wantErr: true},
+		{in: "-1", to: uint(0), wantErr: true},
+		{in: 2, to: float64(0), want: 2.0},
+		{in: "2.5", to: float64(0), want: 2.5},
+		{in: int64(1<<53 + 1), to: float64(0), wantErr: true},
+		{in: "true", to: false, want: true},
+		{in: 1, to: false, want: true},
+		{in: 2, to: false, wantErr: true},
+		{in: "yes", to: false, wantErr: true},
+		{in: 8080, to: "", want: "8080"},
+		{in: "1m30s", to: time.Duration(0), want: 90 * time.Second},
+		{in: "10MB", to: ByteSize(0), want: 10 * MB},
+		{in: uint64(512), to: ByteSize(0), want: ByteSize(512)},
+		{in: "2022-09-01T10:00:00Z", to: time.Time{}, want: time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		got, err := convertScalar(test.in, reflect.TypeOf(test.to))
+
+		switch {
+		case test.wantErr && err == nil:
+			t.Errorf("convertScalar(%#v, %T) = %v, want an error", test.in, test.to, got)
+		case !test.wantErr && err != nil:
+			t.Errorf("convertScalar(%#v, %T) error = %v", test.in, test.to, err)
+		case !test.wantErr && !reflect.DeepEqual(got.Interface(), test.want):
+			t.Errorf("convertScalar(%#v, %T) = %#v, want %#v", test.in, test.to, got.Interface(), test.want)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ByteSize
+		wantErr bool
+	}{
+		{in: "512", want: 512},
+		{in: "1KB", want: KB},
+		{in: "1.5 GiB", want: GB + GB/2},
+		{in: "10mb", want: 10 * MB},
+		{in: "MB", wantErr: true},
+		{in: "10 parsecs", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseByteSize(test.in)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("ParseByteSize(%q) = %v, %v, want %v", test.in, got, err, test.want)
+		}
+	}
+}
+
+type decodeHook struct {
+	Type  string   `libra:"type"`
+	Level []string `libra:"levels"`
+}
+
+type decodeBase struct {
+	Name string `libra:"name,required"`
+}
+
+type decodeConfig struct {
+	decodeBase
+	Timeout time.Duration     `libra:"timeout,default=5s"`
+	MaxSize ByteSize          `libra:"max_size"`
+	Port    uint16            `libra:"port"`
+	Hooks   []decodeHook      `libra:"hooks"`
+	Labels  map[string]string `libra:"labels"`
+	Skipped string            `libra:"-"`
+	TLS     *struct {
+		Cert string `libra:"cert,required"`
+	} `libra:"tls"`
+}
+
+func TestDecode(t *testing.T) {
+	h := New()
+	if err := h.MergeConfigMap(map[string]interface{}{
+		"Name":     "api",
+		"max_size": "10MB",
+		"port":     "8080",
+		"hooks":    []interface{}{map[string]interface{}{"type": "file", "levels": "error"}},
+		"labels":   map[string]interface{}{"team": "core"},
+		"skipped":  "x",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var c decodeConfig
+	if err := h.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	want := decodeConfig{
+		decodeBase: decodeBase{Name: "api"},
+		Timeout:    5 * time.Second,
+		MaxSize:    10 * MB,
+		Port:       8080,
+		Hooks:      []decodeHook{{Type: "file", Level: []string{"error"}}},
+		Labels:     map[string]string{"team": "core"},
+	}
+
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Decode = %+v, want %+v", c, want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	h := New()
+	if err := h.MergeConfigMap(map[string]interface{}{
+		"port": 70000,
+		"tls":  map[string]interface{}{},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var c decodeConfig
+
+	err := h.Decode(&c)
+
+	decodeErr, ok := err.(*DecodeError)
+	if !ok {
+		t.Fatalf("Decode error = %v, want a *DecodeError", err)
+	}
+
+	if want := []string{"name", "tls.cert"}; !reflect.DeepEqual(decodeErr.Missing, want) {
+		t.Errorf("Missing = %v, want %v", decodeErr.Missing, want)
+	}
+
+	if len(decodeErr.Errors) != 1 {
+		t.Errorf("Errors = %v, want the overflowing port only", decodeErr.Errors)
+	}
+
+	if err := decode(map[string]interface{}{}, c); err == nil {
+		t.Error("decode into a non-pointer succeeded")
+	}
+}
+
+func TestFromStruct(t *testing.T) {
+	h, err := FromStruct(decodeConfig{
+		decodeBase: decodeBase{Name: "api"},
+		Timeout:    time.Second,
+		Hooks:      []decodeHook{{Type: "file"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := h.GetString("name"); got != "api" {
+		t.Errorf("name = %q, want api", got)
+	}
+
+	if got := h.GetString("hooks.0.type"); got != "file" {
+		t.Errorf("hooks.0.type = %q, want file", got)
+	}
+
+	if h.IsSet("skipped") || h.IsSet("tls") {
+		t.Errorf("FromStruct kept skipped or nil fields: %v", h.AllKeys())
+	}
+
+	var c decodeConfig
+	if err := h.Decode(&c); err != nil || c.Timeout != time.Second {
+		t.Errorf("round trip = %+v, %v", c, err)
+	}
+}
@@ -0,0 +1,139 @@
+package hierarchy
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind tells how a path differs between two hierarchies.
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeRemoved ChangeKind = "removed"
+	ChangeChanged ChangeKind = "changed"
+)
+
+// Change is a path whose value differs, with array items addressed by index, e.g. `hooks.1.level`.
+type Change struct {
+	Path string      `json:"path"`
+	Kind ChangeKind  `json:"kind"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %s: %v", c.Path, c.New)
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s: %v", c.Path, c.Old)
+	default:
+		return fmt.Sprintf("~ %s: %v -> %v", c.Path, c.Old, c.New)
+	}
+}
+
+// Changes lists changes sorted by path.
+type Changes []Change
+
+// Text renders one change per line, prefixed by +, - or ~.
+func (c Changes) Text() string {
+	var buf strings.Builder
+
+	for _, change := range c {
+		buf.WriteString(change.String())
+		buf.WriteByte('\n')
+	}
+
+	return buf.String()
+}
+
+// JSON renders the changes as a JSON array.
+func (c Changes) JSON() ([]byte, error) {
+	if c == nil {
+		return []byte("[]"), nil
+	}
+
+	return json.Marshal([]Change(c))
+}
+
+// Diff returns the paths added, removed or changed from the resolved settings of a to those of b.
+// The values of keys sensitive in a or b are redacted, see MarkSensitive.
+func Diff(a, b *Hierarchy) Changes {
+	changes := diffSettings(a.AllSettings(), b.AllSettings())
+	sa, sb := a.base().sensitivity(), b.base().sensitivity()
+
+	for index, change := range changes {
+		pathA := append(splitKey(a.prefix), splitKey(change.Path)...)
+		pathB := append(splitKey(b.prefix), splitKey(change.Path)...)
+
+		// Added or removed arrays and maps may have sensitive keys inside.
+		changes[index].Old = sb.redact(pathB, sa.redact(pathA, change.Old))
+		changes[index].New = sb.redact(pathB, sa.redact(pathA, change.New))
+	}
+
+	return changes
+}
+
+func diffSettings(before, after map[string]interface{}) Changes {
+	var changes Changes
+
+	diffValue("", before, after, &changes)
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+
+	return changes
+}
+
+func diffValue(path string, before, after interface{}, changes *Changes) {
+	oldMap, oldIsMap := before.(map[string]interface{})
+	newMap, newIsMap := after.(map[string]interface{})
+
+	if oldIsMap && newIsMap {
+		for key, oldChild := range oldMap {
+			if newChild, ok := newMap[key]; ok {
+				diffValue(joinPath(path, key), oldChild, newChild, changes)
+			} else {
+				*changes = append(*changes, Change{Path: joinPath(path, key), Kind: ChangeRemoved, Old: oldChild})
+			}
+		}
+
+		for key, newChild := range newMap {
+			if _, ok := oldMap[key]; !ok {
+				*changes = append(*changes, Change{Path: joinPath(path, key), Kind: ChangeAdded, New: newChild})
+			}
+		}
+
+		return
+	}
+
+	oldItems, oldIsSlice := before.([]interface{})
+	newItems, newIsSlice := after.([]interface{})
+
+	if oldIsSlice && newIsSlice {
+		for index := 0; index < len(oldItems) || index < len(newItems); index++ {
+			itemPath := joinPath(path, strconv.Itoa(index))
+
+			switch {
+			case index >= len(newItems):
+				*changes = append(*changes, Change{Path: itemPath, Kind: ChangeRemoved, Old: oldItems[index]})
+			case index >= len(oldItems):
+				*changes = append(*changes, Change{Path: itemPath, Kind: ChangeAdded, New: newItems[index]})
+			default:
+				diffValue(itemPath, oldItems[index], newItems[index], changes)
+			}
+		}
+
+		return
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		*changes = append(*changes, Change{Path: path, Kind: ChangeChanged, Old: before, New: after})
+	}
+}
@@ -0,0 +1,87 @@
+package hierarchy
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a := New()
+	if err := a.LoadAssetMap(map[string][]byte{"app.yaml": []byte(hooksYAML)}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New()
+	if err := b.LoadAssetMap(map[string][]byte{"app.yaml": []byte(hooksYAML)}); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Set("logger.hooks.1.level", "warn")
+	b.Set("logger.hooks.+", map[string]interface{}{"type": "syslog"})
+	b.Set("logger.name", "api")
+	b.Delete("logger.level")
+
+	want := Changes{
+		{Path: "logger.hooks.1.level", Kind: ChangeChanged, Old: "debug", New: "warn"},
+		{Path: "logger.hooks.2", Kind: ChangeAdded, New: map[string]interface{}{"type": "syslog"}},
+		{Path: "logger.level", Kind: ChangeRemoved, Old: "info"},
+		{Path: "logger.name", Kind: ChangeAdded, New: "api"},
+	}
+
+	changes := Diff(a, b)
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("Diff = %v, want %v", changes, want)
+	}
+
+	wantText := "~ logger.hooks.1.level: debug -> warn\n+ logger.hooks.2: map[type:syslog]\n" +
+		"- logger.level: info\n+ logger.name: api\n"
+	if got := changes.Text(); got != wantText {
+		t.Errorf("Text =\n%s\nwant\n%s", got, wantText)
+	}
+
+	if changes := Diff(a, a); len(changes) != 0 {
+		t.Errorf("Diff(a, a) = %v, want none", changes)
+	}
+
+	if data, err := Changes(nil).JSON(); err != nil || string(data) != "[]" {
+		t.Errorf("JSON of no changes = %s, %v, want []", data, err)
+	}
+}
+
+func TestDiffRedacts(t *testing.T) {
+	a := New()
+	a.Set("db.host", "localhost")
+	a.Set("db.password", "hunter2")
+
+	b := New()
+	b.Set("db.host", "db.internal")
+	b.Set("db.password", "correct horse")
+	b.Set("api.token", "s3cr3t")
+	b.MarkSensitive("db.password", "api.*")
+
+	data, err := Diff(a, b).JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []Change
+	if err := json.Unmarshal(data, &changes); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 3 {
+		t.Fatalf("Diff = %s, want 3 changes", data)
+	}
+
+	for _, secret := range []string{"hunter2", "correct horse", "s3cr3t"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Diff = %s, want %q redacted", data, secret)
+		}
+	}
+
+	if !strings.Contains(string(data), "db.internal") {
+		t.Errorf("Diff = %s, want db.host shown", data)
+	}
+}
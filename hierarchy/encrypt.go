@@ -0,0 +1,403 @@
+package hierarchy
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidKey       = errors.New("invalid data key")
+	ErrMissingKey       = errors.New("missing data key")
+	ErrInvalidEncrypted = errors.New("invalid encrypted value")
+)
+
+// KeyEnv is the env var holding the data key when LoadAssetMap is given no KeyProvider.
+const KeyEnv = "LIBRA_KEY"
+
+// encryptedExp matches values encrypted like SOPS does,
+// e.g. `ENC[AES256_GCM,data:...,iv:...,tag:...,type:str]`.
+var encryptedExp = regexp.MustCompile(`^ENC\[AES256_GCM,data:([A-Za-z0-9+/=]*),iv:([A-Za-z0-9+/=]+),tag:([A-Za-z0-9+/=]+),type:(str|int|float|bool)\]$`)
+
+// KeyProvider provides the AES-256 data key encrypting values.
+type KeyProvider interface {
+	Key() ([]byte, error)
+}
+
+// KeyProviderFunc adapts a function to KeyProvider.
+type KeyProviderFunc func() ([]byte, error)
+
+func (f KeyProviderFunc) Key() ([]byte, error) {
+	return f()
+}
+
+// StaticKey provides key, which must be 32 bytes long.
+func StaticKey(key []byte) KeyProvider {
+	return KeyProviderFunc(func() ([]byte, error) {
+		return checkKey(key)
+	})
+}
+
+// EnvKey reads the data key from the env var name, in base64 or hex,
+// e.g. generated with `openssl rand -base64 32`.
+func EnvKey(name string) KeyProvider {
+	return KeyProviderFunc(func() ([]byte, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is not set", ErrMissingKey, name)
+		}
+
+		return parseKey(value)
+	})
+}
+
+// FileKey reads the data key from file, in base64 or hex.
+func FileKey(file string) KeyProvider {
+	return KeyProviderFunc(func() ([]byte, error) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMissingKey, err)
+		}
+
+		return parseKey(string(data))
+	})
+}
+
+// WithKeyProvider decrypts the encrypted values of assets with the key of p, instead of
+// the one in the KeyEnv env var.
+func WithKeyProvider(p KeyProvider) LoadOption {
+	return func(l *loader) {
+		l.keys = p
+	}
+}
+
+func parseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(key) != 32 {
+		key, err = hex.DecodeString(s)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: expected 32 bytes in base64 or hex", ErrInvalidKey)
+	}
+
+	return checkKey(key)
+}
+
+func checkKey(key []byte) ([]byte, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%w: %d bytes instead of 32", ErrInvalidKey, len(key))
+	}
+
+	return key, nil
+}
+
+// IsEncrypted reports whether value is an encrypted value.
+func IsEncrypted(value interface{}) bool {
+	s, ok := value.(string)
+
+	return ok && encryptedExp.MatchString(s)
+}
+
+// EncryptValue encrypts the scalar value of the key at keyPath within its asset, e.g.
+// `database.password`. Like SOPS, the result is bound to this path, array indexes aside:
+// it fails to decrypt under any other key.
+func EncryptValue(key []byte, keyPath string, value interface{}) (string, error) {
+	return encryptValue(key, splitKey(keyPath), value)
+}
+
+func encryptValue(key []byte, path []string, value interface{}) (string, error) {
+	var plain, typ string
+
+	switch v := value.(type) {
+	case string:
+		plain, typ = v, "str"
+	case bool:
+		plain, typ = strconv.FormatBool(v), "bool"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		plain, typ = fmt.Sprint(v), "int"
+	case float32, float64:
+		plain, typ = fmt.Sprint(v), "float"
+	default:
+		return "", fmt.Errorf("%w: cannot encrypt %T", ErrInvalidEncrypted, value)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nil, iv, []byte(plain), additionalData(path))
+	data, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+	encode := base64.StdEncoding.EncodeToString
+
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]", encode(data), encode(iv), encode(tag), typ), nil
+}
+
+// DecryptValue decrypts the encrypted value s of the key at keyPath within its asset.
+func DecryptValue(key []byte, keyPath, s string) (interface{}, error) {
+	return decryptValue(key, splitKey(keyPath), s)
+}
+
+func decryptValue(key []byte, path []string, s string) (interface{}, error) {
+	name := strings.Join(path, ".")
+
+	match := encryptedExp.FindStringSubmatch(s)
+	if match == nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidEncrypted, name)
+	}
+
+	parts := make([][]byte, 3)
+
+	for index := range parts {
+		var err error
+
+		if parts[index], err = base64.StdEncoding.DecodeString(match[index+1]); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidEncrypted, name, err)
+		}
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parts[1]) != gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: %s: bad iv", ErrInvalidEncrypted, name)
+	}
+
+	plain, err := gcm.Open(nil, parts[1], append(parts[0], parts[2]...), additionalData(path))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: wrong key or key path", ErrInvalidEncrypted, name)
+	}
+
+	switch match[4] {
+	case "bool":
+		return strconv.ParseBool(string(plain))
+	case "int":
+		return parseInt(string(plain))
+	case "float":
+		return strconv.ParseFloat(string(plain), 64)
+	default:
+		return string(plain), nil
+	}
+}
+
+// parseInt parses an encrypted int, which may be an uint64 too large for an int64.
+func parseInt(s string) (interface{}, error) {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err == nil {
+		if int64(int(i)) == i {
+			return int(i), nil
+		}
+
+		return i, nil
+	}
+
+	u, uerr := strconv.ParseUint(s, 10, 64)
+	if uerr != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// additionalData binds an encrypted value to the lowercased key path, skipping array
+// indexes, as SOPS does: `database:password:`.
+func additionalData(path []string) []byte {
+	var buf strings.Builder
+
+	for _, segment := range path {
+		if !isIndex(segment) {
+			buf.WriteString(strings.ToLower(segment))
+			buf.WriteByte(':')
+		}
+	}
+
+	return []byte(buf.String())
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if _, err := checkKey(key); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// decrypt decrypts the encrypted values of a loaded asset, marking their paths sensitive in
+// notes.
+func (l *loader) decrypt(name string, value interface{}, notes *annotations) (interface{}, error) {
+	var key []byte
+
+	return mapLeaves(nil, value, func(path []string, leaf interface{}) (interface{}, error) {
+		s, ok := leaf.(string)
+		if !ok || !encryptedExp.MatchString(s) {
+			return leaf, nil
+		}
+
+		if key == nil {
+			keys := l.keys
+			if keys == nil {
+				keys = EnvKey(KeyEnv)
+			}
+
+			var err error
+			if key, err = keys.Key(); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+
+		decrypted, err := decryptValue(key, path, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		notes.sensitive[strings.Join(path, ".")] = true
+
+		return decrypted, nil
+	})
+}
+
+// mapLeaves replaces every leaf under value, at path, with what fn returns.
+func mapLeaves(path []string, value interface{}, fn func(path []string, leaf interface{}) (interface{}, error)) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			child, err := mapLeaves(append(path[:len(path):len(path)], key), v[key], fn)
+			if err != nil {
+				return nil, err
+			}
+
+			v[key] = child
+		}
+
+		return v, nil
+	case []interface{}:
+		for index, item := range v {
+			child, err := mapLeaves(append(path[:len(path):len(path)], strconv.Itoa(index)), item, fn)
+			if err != nil {
+				return nil, err
+			}
+
+			v[index] = child
+		}
+
+		return v, nil
+	default:
+		return fn(path, value)
+	}
+}
+
+// EncryptAsset encrypts the values of the keys of the YAML, JSON or TOML asset name
+// matching patterns, see MarkSensitive, or DefaultSensitiveKeys if none. Values already
+// encrypted are left alone, and so are comments and the layout of the asset.
+func EncryptAsset(name string, data []byte, key []byte, patterns ...string) ([]byte, error) {
+	if len(patterns) == 0 {
+		patterns = DefaultSensitiveKeys
+	}
+
+	s := &sensitivity{}
+	for _, pattern := range patterns {
+		s.add(pattern)
+	}
+
+	return rewriteLeaves(name, data, func(path []string, leaf interface{}) (interface{}, bool, error) {
+		if leaf == nil || IsEncrypted(leaf) || !s.matches(path) {
+			return nil, false, nil
+		}
+
+		encrypted, err := encryptValue(key, path, leaf)
+
+		return encrypted, err == nil, err
+	})
+}
+
+// DecryptAsset decrypts the encrypted values of the YAML, JSON or TOML asset name, leaving
+// comments and the layout of the asset alone.
+func DecryptAsset(name string, data []byte, key []byte) ([]byte, error) {
+	return rewriteLeaves(name, data, func(path []string, leaf interface{}) (interface{}, bool, error) {
+		s, ok := leaf.(string)
+		if !ok || !encryptedExp.MatchString(s) {
+			return nil, false, nil
+		}
+
+		decrypted, err := decryptValue(key, path, s)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return decrypted, true, nil
+	})
+}
+
+// rewriteLeaves sets the leaves of the asset name for which fn returns true to the value it
+// returns, through an assetEditor.
+func rewriteLeaves(name string, data []byte, fn func(path []string, leaf interface{}) (interface{}, bool, error)) ([]byte, error) {
+	var tree interface{}
+
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".yaml", ".yml", ".json":
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &tree); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	default:
+		return nil, viper.UnsupportedConfigError(strings.TrimPrefix(ext, "."))
+	}
+
+	editor, err := newAssetEditor(name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = mapLeaves(nil, tree, func(path []string, leaf interface{}) (interface{}, error) {
+		value, ok, err := fn(path, leaf)
+		if err == nil && ok {
+			err = editor.set(path, value)
+		}
+
+		return leaf, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return editor.bytes()
+}
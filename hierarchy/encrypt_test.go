@@ -0,0 +1,96 @@
+package hierarchy
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+var testKey = bytes.Repeat([]byte{7}, 32)
+
+func TestEncryptValue(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  interface{}
+	}{
+		{value: "s3cret", want: "s3cret"},
+		{value: true, want: true},
+		{value: int32(-42), want: -42},
+		{value: uint64(math.MaxUint64), want: uint64(math.MaxUint64)},
+		{value: 1.5, want: 1.5},
+	}
+
+	for _, test := range tests {
+		encrypted, err := EncryptValue(testKey, "database.password", test.value)
+		if err != nil {
+			t.Fatalf("EncryptValue(%#v) error = %v", test.value, err)
+		}
+
+		if got, err := DecryptValue(testKey, "Database.Password", encrypted); err != nil || got != test.want {
+			t.Errorf("DecryptValue(%#v) = %#v, %v, want %#v", test.value, got, err, test.want)
+		}
+	}
+
+	encrypted, err := EncryptValue(testKey, "database.hosts.0.password", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The path binds the value, array indexes aside.
+	if _, err := DecryptValue(testKey, "database.hosts.3.password", encrypted); err != nil {
+		t.Errorf("DecryptValue at another index error = %v", err)
+	}
+
+	for _, keyPath := range []string{"cache.password", "password", "database.hosts.0.token"} {
+		if _, err := DecryptValue(testKey, keyPath, encrypted); !errors.Is(err, ErrInvalidEncrypted) {
+			t.Errorf("DecryptValue(%s) error = %v, want ErrInvalidEncrypted", keyPath, err)
+		}
+	}
+}
+
+func TestLoadEncrypted(t *testing.T) {
+	asset, err := EncryptAsset("app.yaml", []byte("database:\n  user: admin\n  password: s3cret # rotated\n"), testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(asset), "ENC[AES256_GCM") || !strings.Contains(string(asset), "# rotated") {
+		t.Fatalf("EncryptAsset = %s, want the password encrypted and the comment kept", asset)
+	}
+
+	h := New(SensitiveKeys())
+	if err := h.LoadAssetMap(map[string][]byte{"app.yaml": asset}, WithKeyProvider(StaticKey(testKey))); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := h.GetString("database.password"); got != "s3cret" {
+		t.Errorf("database.password = %q, want it decrypted", got)
+	}
+
+	// Decrypted values are sensitive even when no pattern matches their key.
+	if !h.IsSensitive("database.password") || h.IsSensitive("database.user") {
+		t.Errorf("IsSensitive(database.password, database.user) = %v, %v, want true, false",
+			h.IsSensitive("database.password"), h.IsSensitive("database.user"))
+	}
+
+	if s := h.String(); strings.Contains(s, "s3cret") {
+		t.Errorf("String() = %s, want the decrypted password redacted", s)
+	}
+
+	// A value moved to another key no longer decrypts.
+	moved := strings.Replace(string(asset), "database:", "cache:", 1)
+	if err := New().LoadAssetMap(map[string][]byte{"app.yaml": []byte(moved)}, WithKeyProvider(StaticKey(testKey))); !errors.Is(err, ErrInvalidEncrypted) {
+		t.Errorf("LoadAssetMap moved value error = %v, want ErrInvalidEncrypted", err)
+	}
+
+	decrypted, err := DecryptAsset("app.yaml", asset, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(decrypted), "password: s3cret # rotated") {
+		t.Errorf("DecryptAsset = %s", decrypted)
+	}
+}
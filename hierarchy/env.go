@@ -0,0 +1,326 @@
+package hierarchy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidEnv = errors.New("invalid env var")
+
+var envNameExp = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// EnvVar is an env var applied by LoadEnv.
+type EnvVar struct {
+	Name string
+	Key  string
+	// Value is the value of the env var, converted to the type of the value it overrides.
+	// The values of sensitive keys are masked, see MarkSensitive.
+	Value interface{}
+}
+
+func EnvVars() []EnvVar {
+	return _default.EnvVars()
+}
+
+// EnvVars lists the env vars applied by the last LoadEnv, in the order they were applied.
+func (h *Hierarchy) EnvVars() []EnvVar {
+	root := h.base()
+	envVars := append([]EnvVar{}, root.current.Load().envVars...)
+
+	s := root.sensitivity()
+	for index := range envVars {
+		envVars[index].Value = s.redact(splitKey(envVars[index].Key), envVars[index].Value)
+	}
+
+	return envVars
+}
+
+// envPath maps an env var name to a key path: `_` separates keys and `__` is a literal
+// underscore, e.g. `APP_LOGGER_HOOKS_0_CHAT__ID` is `logger.hooks.0.chat_id` with the
+// prefix `APP`. It returns false for names outside the prefix or with empty keys.
+func envPath(prefix, name string) ([]string, bool) {
+	if prefix != "" {
+		prefix = strings.ToUpper(prefix) + "_"
+		if !strings.HasPrefix(name, prefix) {
+			return nil, false
+		}
+
+		name = name[len(prefix):]
+	}
+
+	path := make([]string, 0, strings.Count(name, "_")+1)
+	segment := make([]byte, 0, len(name))
+
+	for index := 0; index <= len(name); index++ {
+		switch {
+		case index < len(name)-1 && name[index] == '_' && name[index+1] == '_':
+			segment = append(segment, '_')
+			index++
+		case index == len(name) || name[index] == '_':
+			if len(segment) == 0 {
+				return nil, false
+			}
+
+			path = append(path, strings.ToLower(string(segment)))
+			segment = segment[:0]
+		default:
+			segment = append(segment, name[index])
+		}
+	}
+
+	return path, true
+}
+
+// envName maps a key path to the env var name envPath maps back to it.
+func envName(prefix string, path []string) string {
+	segments := make([]string, 0, len(path)+1)
+	if prefix != "" {
+		segments = append(segments, strings.ToUpper(prefix))
+	}
+
+	for _, segment := range path {
+		segment = envNameExp.ReplaceAllString(strings.ToUpper(segment), "_")
+		segments = append(segments, strings.ReplaceAll(segment, "_", "__"))
+	}
+
+	return strings.Join(segments, "_")
+}
+
+// coerceValue converts a string value to the type of the value it overrides. Objects
+// and arrays may be given as JSON, and arrays as comma separated values too.
+func coerceValue(existing interface{}, value string) (interface{}, error) {
+	if trimmed := strings.TrimSpace(value); strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var v interface{}
+
+		err := json.Unmarshal([]byte(trimmed), &v)
+		if err == nil {
+			return insensitivise(v), nil
+		}
+
+		switch existing.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, err
+		}
+	}
+
+	switch existing.(type) {
+	case bool:
+		return strconv.ParseBool(value)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		n, err := strconv.ParseInt(value, 0, 64)
+
+		return int(n), err
+	case float32, float64:
+		return strconv.ParseFloat(value, 64)
+	case []interface{}:
+		items := make([]interface{}, 0)
+		for _, item := range strings.Split(value, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+
+		return items, nil
+	case map[string]interface{}:
+		return nil, fmt.Errorf("%q is not a JSON object", value)
+	default:
+		return value, nil
+	}
+}
+
+// applyEnv replaces the env layer of l with the env vars under prefix. Without a prefix,
+// only the env vars naming existing keys are applied.
+func (h *Hierarchy) applyEnv(l *layers, prefix string) error {
+	l.env = make(map[string]interface{})
+	l.envVars = nil
+
+	for key, origins := range l.origins {
+		kept := make([]Origin, 0, len(origins))
+
+		for _, o := range origins {
+			if o.Kind != SourceEnv {
+				kept = append(kept, o)
+			}
+		}
+
+		if len(kept) > 0 {
+			l.origins[key] = kept
+		} else {
+			delete(l.origins, key)
+		}
+	}
+
+	type envEntry struct {
+		name, value string
+		path        []string
+	}
+
+	entries := make([]envEntry, 0)
+
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if path, ok := envPath(prefix, name); ok {
+			entries = append(entries, envEntry{name: name, value: value, path: path})
+		}
+	}
+
+	// Subtrees given as JSON go first, so that env vars for keys inside them win, then
+	// array items in order, so that each appends to the one before.
+	sort.Slice(entries, func(i, j int) bool {
+		if len(entries[i].path) != len(entries[j].path) {
+			return len(entries[i].path) < len(entries[j].path)
+		}
+
+		return lessPath(entries[i].path, entries[j].path)
+	})
+
+	for _, entry := range entries {
+		if _, found := lookupPath(h.treeOf(l), entry.path); prefix == "" && !found {
+			continue
+		}
+
+		if err := h.setEnv(l, entry.name, entry.value, entry.path); err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(h.envBindings))
+	for key := range h.envBindings {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := h.applyBoundEnv(l, key, h.envBindings[key]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyBoundEnv sets key to the value of the first set env var of names.
+func (h *Hierarchy) applyBoundEnv(l *layers, key string, names []string) error {
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			return h.setEnv(l, name, value, splitKey(key))
+		}
+	}
+
+	return nil
+}
+
+// setEnv sets the value of the env var name at path in the env layer of l, converted to
+// the type of the value it overrides.
+func (h *Hierarchy) setEnv(l *layers, name, value string, path []string) error {
+	tree := h.treeOf(l)
+	existing, _ := lookupPath(tree, path)
+
+	converted, err := coerceValue(existing, value)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidEnv, name, err)
+	}
+
+	if err := setKey(l.env, tree, path, converted); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidEnv, name, err)
+	}
+
+	key := strings.Join(path, ".")
+	l.record(key, converted, func(string) Origin {
+		return Origin{Kind: SourceEnv, Name: name}
+	})
+	l.envVars = append(l.envVars, EnvVar{Name: name, Key: key, Value: converted})
+
+	return nil
+}
+
+// SetEnvPrefix sets the prefix of the env vars read by AutomaticEnv, and by BindEnv by
+// default.
+func (h *Hierarchy) SetEnvPrefix(in string) {
+	b := h.base()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.envPrefix = in
+}
+
+// AutomaticEnv applies the env vars under the prefix of SetEnvPrefix, see LoadEnv. Unlike
+// viper, which reads env vars on every Get, it reads them once: call it once the other
+// sources are loaded, as without a prefix only the env vars of existing keys apply.
+// Errors are logged.
+func (h *Hierarchy) AutomaticEnv() {
+	b := h.base()
+
+	b.mu.Lock()
+	prefix := b.envPrefix
+	b.mu.Unlock()
+
+	if err := b.LoadEnv(prefix); err != nil {
+		log.Printf("hierarchy: %v", err)
+	}
+}
+
+// BindEnv binds the key input[0] to the env vars input[1:], or to the env var named after
+// the key and the prefix of SetEnvPrefix, e.g. `APP_LOGGER_LEVEL`. The key is set to the
+// value of the first one set, now and on every later LoadEnv.
+func (h *Hierarchy) BindEnv(input ...string) error {
+	if len(input) == 0 {
+		return fmt.Errorf("%w: missing key to bind to", ErrInvalidEnv)
+	}
+
+	key := strings.Join(splitKey(h.absolute(input[0])), ".")
+	b := h.base()
+
+	return b.update(func(l *layers) error {
+		names := input[1:]
+		if len(names) == 0 {
+			names = []string{envName(b.envPrefix, splitKey(key))}
+		}
+
+		if err := b.applyBoundEnv(l, key, names); err != nil {
+			return err
+		}
+
+		if b.envBindings == nil {
+			b.envBindings = make(map[string][]string)
+		}
+
+		b.envBindings[key] = names
+
+		return nil
+	})
+}
+
+// MustBindEnv is like BindEnv, but panics on error.
+func (h *Hierarchy) MustBindEnv(input ...string) {
+	if err := h.BindEnv(input...); err != nil {
+		panic(fmt.Sprintf("hierarchy: %v", err))
+	}
+}
+
+// lessPath orders paths segment by segment, comparing array indexes as numbers.
+func lessPath(a, b []string) bool {
+	for index := 0; index < len(a) && index < len(b); index++ {
+		if a[index] == b[index] {
+			continue
+		}
+
+		x, errX := strconv.Atoi(a[index])
+		y, errY := strconv.Atoi(b[index])
+
+		if errX == nil && errY == nil {
+			return x < y
+		}
+
+		return a[index] < b[index]
+	}
+
+	return len(a) < len(b)
+}
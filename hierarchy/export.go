@@ -0,0 +1,201 @@
+package hierarchy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/printer"
+	"github.com/hashicorp/hcl/hcl/token"
+	jsonparser "github.com/hashicorp/hcl/json/parser"
+	"github.com/magiconair/properties"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/encoding/prototext"
+	"gopkg.in/yaml.v3"
+)
+
+var envBareValueExp = regexp.MustCompile(`^[A-Za-z0-9_./:@+,-]*$`)
+
+func Export(format string) ([]byte, error) {
+	return _default.Export(format)
+}
+
+// Export encodes every resolved setting in format: json, yaml, toml, hcl, properties,
+// dotenv, or textproto and pb for google.protobuf.Struct messages. Nested keys are
+// flattened in properties, e.g. `hooks[0].type`, and in dotenv, e.g. `HOOKS_0_TYPE`, with
+// the env prefix of LoadEnv if any. Unlike JSON and String, Export does not redact
+// sensitive values.
+func (h *Hierarchy) Export(format string) ([]byte, error) {
+	settings, _ := exportValue(h.AllSettings()).(map[string]interface{})
+
+	switch strings.ToLower(format) {
+	case "json":
+		data, err := json.MarshalIndent(settings, "", "  ")
+
+		return append(data, '\n'), err
+	case "yaml", "yml":
+		var buf bytes.Buffer
+
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+
+		if err := encoder.Encode(settings); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), encoder.Close()
+	case "toml":
+		return toml.Marshal(settings)
+	case "hcl":
+		return exportHCL(settings)
+	case "properties", "props", "prop":
+		return exportProperties(settings)
+	case "textproto", "txtpb", "pbtxt":
+		s, err := h.snapshotStruct()
+		if err != nil {
+			return nil, err
+		}
+
+		return prototext.MarshalOptions{Multiline: true}.Marshal(s)
+	case "pb", "binpb":
+		return h.MarshalProto()
+	case "env", "dotenv":
+		base := h.base()
+		base.mu.Lock()
+		prefix := base.envPrefix
+		base.mu.Unlock()
+
+		return exportDotenv(settings, prefix), nil
+	default:
+		return nil, viper.UnsupportedConfigError(format)
+	}
+}
+
+// flattenLeaves calls fn with the path of every leaf under value, in key order.
+func flattenLeaves(path []string, value interface{}, fn func(path []string, value interface{})) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			flattenLeaves(append(path[:len(path):len(path)], key), v[key], fn)
+		}
+	case []interface{}:
+		for index, item := range v {
+			flattenLeaves(append(path[:len(path):len(path)], fmt.Sprint(index)), item, fn)
+		}
+	default:
+		fn(path, value)
+	}
+}
+
+func exportProperties(settings map[string]interface{}) ([]byte, error) {
+	p := properties.NewProperties()
+	p.DisableExpansion = true
+
+	var err error
+
+	flattenLeaves(nil, settings, func(path []string, value interface{}) {
+		var key strings.Builder
+
+		for index, segment := range path {
+			switch {
+			case index > 0 && isIndex(segment):
+				fmt.Fprintf(&key, "[%s]", segment)
+			case index > 0:
+				key.WriteString("." + segment)
+			default:
+				key.WriteString(segment)
+			}
+		}
+
+		if value == nil {
+			value = ""
+		}
+
+		if _, _, setErr := p.Set(key.String(), fmt.Sprint(value)); setErr != nil && err == nil {
+			err = setErr
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if _, err := p.Write(&buf, properties.UTF8); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func isIndex(segment string) bool {
+	return segment != "" && strings.Trim(segment, "0123456789") == ""
+}
+
+func exportDotenv(settings map[string]interface{}, prefix string) []byte {
+	var buf bytes.Buffer
+
+	flattenLeaves(nil, settings, func(path []string, value interface{}) {
+		name := envName(prefix, path)
+
+		s := ""
+		if value != nil {
+			s = fmt.Sprint(value)
+		}
+
+		if !envBareValueExp.MatchString(s) {
+			s = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`).Replace(s) + `"`
+		}
+
+		fmt.Fprintf(&buf, "%s=%s\n", name, s)
+	})
+
+	return buf.Bytes()
+}
+
+// exportHCL converts the settings through JSON, which HCL parses, then prints the result
+// as HCL with bare keys where possible.
+func exportHCL(settings map[string]interface{}) ([]byte, error) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := jsonparser.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ast.Walk(file.Node, func(node ast.Node) (ast.Node, bool) {
+		if item, ok := node.(*ast.ObjectItem); ok {
+			for _, key := range item.Keys {
+				if name := strings.Trim(key.Token.Text, `"`); identifierExp.MatchString(name) {
+					key.Token = token.Token{Type: token.IDENT, Pos: key.Token.Pos, Text: name}
+				}
+			}
+		}
+
+		return node, true
+	})
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, file); err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
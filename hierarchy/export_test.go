@@ -0,0 +1,165 @@
+package hierarchy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const loggerTOML = `# logging
+[logger]
+name = "run" # the logger
+
+[[logger.hooks]]
+type = "file" # rotated
+level = 'info'
+
+[[logger.hooks]]
+type = "stdout"
+level = "debug"
+`
+
+func TestRewriteTOMLTables(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(h *Hierarchy)
+		want string
+	}{
+		{
+			name: "item key",
+			edit: func(h *Hierarchy) { h.Set("logger.hooks.1.level", "warn") },
+			want: strings.Replace(loggerTOML, `level = "debug"`, `level = "warn"`, 1),
+		},
+		{
+			name: "appended item",
+			edit: func(h *Hierarchy) { h.Set("logger.hooks.+", map[string]interface{}{"type": "stderr"}) },
+			want: loggerTOML + "\n[[logger.hooks]]\ntype = \"stderr\"\n",
+		},
+		{
+			name: "deleted item",
+			edit: func(h *Hierarchy) { h.Delete("logger.hooks.1") },
+			want: strings.TrimSuffix(loggerTOML, "\n[[logger.hooks]]\ntype = \"stdout\"\nlevel = \"debug\"\n"),
+		},
+		{
+			name: "deleted item key",
+			edit: func(h *Hierarchy) { h.Delete("logger.hooks.0.level") },
+			want: strings.Replace(loggerTOML, "level = 'info'\n", "", 1),
+		},
+	}
+
+	for _, test := range tests {
+		h := New()
+		if err := h.LoadAssetMap(map[string][]byte{"app.toml": []byte(loggerTOML)}); err != nil {
+			t.Fatal(err)
+		}
+
+		test.edit(h)
+
+		got, err := h.Rewrite("app.toml", []byte(loggerTOML))
+		if err != nil {
+			t.Errorf("%s: Rewrite error = %v", test.name, err)
+		} else if string(got) != test.want {
+			t.Errorf("%s: Rewrite =\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRewriteNestedTOMLTables(t *testing.T) {
+	data := "[[a]]\nname = \"x\"\n[a.opts]\nk = 1\n[[a.c]]\nv = 1\n[[a.c]]\nv = 2\n\n[[a]]\nname = \"y\"\n"
+
+	h := New()
+	if err := h.LoadAssetMap(map[string][]byte{"app.toml": []byte(data)}); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Set("a.0.c.1.v", 20)
+	h.Set("a.0.opts.j", 5)
+
+	got, err := h.Rewrite("app.toml", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.NewReplacer("k = 1\n", "k = 1\nj = 5\n", "v = 2", "v = 20").Replace(data)
+	if string(got) != want {
+		t.Errorf("Rewrite =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRewriteYAML(t *testing.T) {
+	data := []byte("# service\n\nname: api # the name\nport: 80 # http\nhooks:\n  - type: file\n")
+
+	h := New()
+	if err := h.LoadAssetMap(map[string][]byte{"app.yaml": data}); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Set("port", 8080)
+	h.Set("hooks.0.level", "warn")
+	h.Delete("name")
+
+	got, err := h.Rewrite("app.yaml", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "# service\n\nport: 8080 # http\nhooks:\n  - type: file\n    level: warn\n"; string(got) != want {
+		t.Errorf("Rewrite =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteConfigAs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.toml")
+	if err := os.WriteFile(file, []byte("# kept by Rewrite only\nname = \"api\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := New()
+	h.SetDefault("level", "info")
+	h.Set("name", "worker")
+
+	if err := h.WriteConfigAs(file); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every setting is written, defaults included, over what the file held.
+	if got := string(data); strings.Contains(got, "#") || !strings.Contains(got, "level = 'info'") ||
+		!strings.Contains(got, "name = 'worker'") {
+		t.Errorf("WriteConfigAs wrote\n%s", got)
+	}
+}
+
+func TestExport(t *testing.T) {
+	h := New()
+	h.Set("server.port", 8080)
+	h.Set("server.hosts", []interface{}{"a", "b"})
+
+	tests := map[string][]string{
+		"json":       {`"port": 8080`},
+		"yaml":       {"port: 8080", "- a"},
+		"properties": {"server.port = 8080", "server.hosts[1] = b"},
+		"dotenv":     {"SERVER_PORT=8080", "SERVER_HOSTS_1=b"},
+		"hcl":        {"port = 8080"},
+	}
+
+	for format, wants := range tests {
+		data, err := h.Export(format)
+		if err != nil {
+			t.Errorf("Export(%s) error = %v", format, err)
+
+			continue
+		}
+
+		for _, want := range wants {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("Export(%s) =\n%s\nwant it to contain %q", format, data, want)
+			}
+		}
+	}
+}
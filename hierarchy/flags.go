@@ -0,0 +1,636 @@
+package hierarchy
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidSet   = errors.New("invalid set flag")
+	ErrFlagsTarget  = errors.New("flags target should be a struct")
+	errMissingEqual = errors.New("missing =")
+)
+
+const (
+	// SetFlag sets values, e.g. `--set logger.level=debug,logger.hooks[0].size=10`.
+	SetFlag = "set"
+	// SetFileFlag sets values to the content of files, e.g. `--set-file tls.cert=cert.pem`.
+	SetFileFlag = "set-file"
+	// SetJSONFlag sets JSON values, e.g. `--set-json 'logger.hooks=[{"type":"file"}]'`.
+	SetJSONFlag = "set-json"
+	// noDefaultAnnotation marks generated flags without a default, bound only when set.
+	noDefaultAnnotation = "libra-no-default"
+)
+
+// AddSetFlags registers the --set, --set-file and --set-json flags on flags.
+func AddSetFlags(flags *pflag.FlagSet) {
+	flags.StringArray(SetFlag, nil, "set values, e.g. logger.level=debug,logger.tags={a,b}")
+	flags.StringArray(SetFileFlag, nil, "set values to the content of files, e.g. tls.cert=cert.pem")
+	flags.StringArray(SetJSONFlag, nil, `set JSON values, e.g. logger.hooks=[{"type":"file"}]`)
+}
+
+// isReservedFlag tells the flags LoadFlags reads itself rather than binding them to keys.
+func isReservedFlag(name string) bool {
+	return name == ProfilesFlag || name == SetFlag || name == SetFileFlag || name == SetJSONFlag
+}
+
+// setValue is a value given to one of the set flags.
+type setValue struct {
+	flag, key string
+	value     interface{}
+	// raw is a --set value, converted to the type of the value it overrides if any.
+	raw    string
+	coerce bool
+}
+
+// parseSetFlags parses the set flags in the order Helm applies them: --set-json,
+// --set, then --set-file.
+func parseSetFlags(flags *pflag.FlagSet) ([]setValue, error) {
+	values := make([]setValue, 0)
+
+	for _, name := range []string{SetJSONFlag, SetFlag, SetFileFlag} {
+		if flag := flags.Lookup(name); flag == nil || !flag.Changed {
+			continue
+		}
+
+		args, err := flags.GetStringArray(name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, arg := range args {
+			parsed, err := parseSetArg(name, arg)
+			if err != nil {
+				return nil, fmt.Errorf("%w: --%s %v", ErrInvalidSet, name, err)
+			}
+
+			values = append(values, parsed...)
+		}
+	}
+
+	return values, nil
+}
+
+// parseSetArg parses comma separated key=value pairs. In --set values, `\,` is a comma
+// and `{a,b}` a list; --set-json values are read as whole JSON values. Errors name keys
+// but not values, which may be secrets.
+func parseSetArg(flag, arg string) ([]setValue, error) {
+	values := make([]setValue, 0)
+
+	for arg != "" {
+		eq := strings.IndexByte(arg, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("pair %d: %w", len(values)+1, errMissingEqual)
+		}
+
+		key, rest := arg[:eq], arg[eq+1:]
+		v := setValue{flag: flag, key: key}
+
+		switch flag {
+		case SetJSONFlag:
+			decoder := json.NewDecoder(strings.NewReader(rest))
+			if err := decoder.Decode(&v.value); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+
+			rest = strings.TrimSpace(rest[decoder.InputOffset():])
+			if rest != "" && rest[0] != ',' {
+				return nil, fmt.Errorf("%s: unexpected data after JSON value", key)
+			}
+		default:
+			raw, end := scanSetValue(rest)
+			rest = rest[end:]
+
+			if flag == SetFileFlag {
+				data, err := os.ReadFile(raw)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", key, err)
+				}
+
+				v.value = string(data)
+			} else {
+				v.value, v.raw, v.coerce = inferSetValue(raw), raw, true
+			}
+		}
+
+		values = append(values, v)
+		arg = strings.TrimPrefix(rest, ",")
+	}
+
+	return values, nil
+}
+
+// scanSetValue returns the unescaped value at the start of s and the offset past it.
+func scanSetValue(s string) (string, int) {
+	var value strings.Builder
+
+	depth := 0
+
+	for index := 0; index < len(s); index++ {
+		switch c := s[index]; {
+		case c == '\\' && index+1 < len(s):
+			index++
+			value.WriteByte(s[index])
+		case c == ',' && depth == 0:
+			return value.String(), index
+		default:
+			switch c {
+			case '{':
+				depth++
+			case '}':
+				depth--
+			}
+
+			value.WriteByte(c)
+		}
+	}
+
+	return value.String(), len(s)
+}
+
+// inferSetValue types a --set value: booleans, numbers, `null` which deletes the key,
+// `{a,b}` lists, or strings.
+func inferSetValue(raw string) interface{} {
+	if strings.HasPrefix(raw, "{") && strings.HasSuffix(raw, "}") {
+		items := make([]interface{}, 0)
+
+		if inner := raw[1 : len(raw)-1]; inner != "" {
+			for inner != "" {
+				item, end := scanSetValue(inner)
+				items = append(items, inferSetValue(item))
+				inner = strings.TrimPrefix(inner[end:], ",")
+			}
+		}
+
+		return items
+	}
+
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(raw), &v); err == nil {
+		switch v.(type) {
+		case nil:
+			if raw == "null" {
+				return tombstone{}
+			}
+		case bool, int, float64:
+			return v
+		}
+	}
+
+	return raw
+}
+
+// applySets sets the values of the set flags in the flags layer of l.
+func (h *Hierarchy) applySets(l *layers, values []setValue) error {
+	for _, v := range values {
+		tree := h.treeOf(l)
+		path := splitKey(v.key)
+		value := v.value
+
+		if existing, found := lookupPath(tree, path); found && v.coerce && !isTombstone(value) {
+			if _, isList := value.([]interface{}); !isList {
+				coerced, err := coerceValue(existing, v.raw)
+				if numErr := (*strconv.NumError)(nil); errors.As(err, &numErr) {
+					// Leave out the value, which may be a secret.
+					err = numErr.Err
+				}
+
+				if err != nil {
+					return fmt.Errorf("%w: --%s %s: %v", ErrInvalidSet, v.flag, v.key, err)
+				}
+
+				value = coerced
+			}
+		}
+
+		original := value
+		value = insensitivise(value)
+
+		if err := setKey(l.flags, tree, path, value); err != nil {
+			return fmt.Errorf("%w: --%s %s: %v", ErrInvalidSet, v.flag, v.key, err)
+		}
+
+		name := fmt.Sprintf("--%s %s", v.flag, v.key)
+		l.record(strings.Join(path, "."), value, func(string) Origin {
+			return Origin{Kind: SourceFlag, Name: name}
+		})
+		l.recordKeyCase(v.key)
+		l.recordCases(strings.Join(path, "."), original)
+	}
+
+	return nil
+}
+
+// BindPFlag binds key to flag: its value overrides the key when the flag is given, and
+// its default applies below every other source otherwise. The flag is read when bound,
+// so bind it once parsed.
+func (h *Hierarchy) BindPFlag(key string, flag *pflag.Flag) error {
+	if flag == nil {
+		return fmt.Errorf("%w: flag for %q is nil", ErrInvalidSet, key)
+	}
+
+	return h.update(func(l *layers) error {
+		return h.bindFlag(l, h.absolute(key), flag)
+	})
+}
+
+// BindPFlags binds every flag of flags to the key it is named after, see BindPFlag.
+func (h *Hierarchy) BindPFlags(flags *pflag.FlagSet) error {
+	return h.update(func(l *layers) error {
+		var err error
+
+		flags.VisitAll(func(flag *pflag.Flag) {
+			if err == nil {
+				err = h.bindFlag(l, h.absolute(flag.Name), flag)
+			}
+		})
+
+		return err
+	})
+}
+
+// BindFlagValue binds key to flag like BindPFlag, for flags of other packages than pflag.
+func (h *Hierarchy) BindFlagValue(key string, flag viper.FlagValue) error {
+	if flag == nil {
+		return fmt.Errorf("%w: flag for %q is nil", ErrInvalidSet, key)
+	}
+
+	return h.update(func(l *layers) error {
+		return h.bindFlagValue(l, h.absolute(key), flag.Name(), flag.HasChanged(), flagValueOf(flag))
+	})
+}
+
+// BindFlagValues binds every flag of flags to the key it is named after, see BindFlagValue.
+func (h *Hierarchy) BindFlagValues(flags viper.FlagValueSet) error {
+	return h.update(func(l *layers) error {
+		var err error
+
+		flags.VisitAll(func(flag viper.FlagValue) {
+			if err == nil {
+				err = h.bindFlagValue(l, h.absolute(flag.Name()), flag.Name(), flag.HasChanged(), flagValueOf(flag))
+			}
+		})
+
+		return err
+	})
+}
+
+// bindFlag sets the value of flag at key in the flags layer of l if it was given, or
+// in its flag defaults layer otherwise.
+func (h *Hierarchy) bindFlag(l *layers, key string, flag *pflag.Flag) error {
+	return h.bindFlagValue(l, key, flag.Name, flag.Changed, flagValue(flag))
+}
+
+// bindFlagValue is bindFlag for the value of the flag name, given or not.
+func (h *Hierarchy) bindFlagValue(l *layers, key, name string, changed bool, value interface{}) error {
+	path := splitKey(key)
+	origin := Origin{Kind: SourceFlag, Name: "--" + name}
+
+	if changed {
+		if err := setKey(l.flags, h.treeOf(l), path, value); err != nil {
+			return fmt.Errorf("--%s: %w", name, err)
+		}
+	} else {
+		origin.Kind = SourceDefault
+		setPath(l.flagDefaults, path, value)
+	}
+
+	l.record(strings.Join(path, "."), value, func(string) Origin {
+		return origin
+	})
+
+	return nil
+}
+
+// flagValue returns the value of flag typed after the flag: numbers, booleans and lists,
+// or strings for the other flag types.
+func flagValue(flag *pflag.Flag) interface{} {
+	typ := flag.Value.Type()
+
+	if slice, ok := flag.Value.(pflag.SliceValue); ok {
+		items := make([]interface{}, 0)
+		for _, item := range slice.GetSlice() {
+			items = append(items, flagScalar(strings.TrimSuffix(strings.TrimSuffix(typ, "Slice"), "Array"), item))
+		}
+
+		return items
+	}
+
+	return flagScalar(typ, flag.Value.String())
+}
+
+// flagValueOf is flagValue for a viper.FlagValue, whose lists are rendered like `[a,b]`.
+func flagValueOf(flag viper.FlagValue) interface{} {
+	typ, s := flag.ValueType(), flag.ValueString()
+
+	elem := strings.TrimSuffix(strings.TrimSuffix(typ, "Slice"), "Array")
+	if elem == typ {
+		return flagScalar(typ, s)
+	}
+
+	items := make([]interface{}, 0)
+
+	if s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"); s != "" {
+		fields, err := csv.NewReader(strings.NewReader(s)).Read()
+		if err != nil {
+			return s
+		}
+
+		for _, field := range fields {
+			items = append(items, flagScalar(elem, field))
+		}
+	}
+
+	return items
+}
+
+func flagScalar(typ, s string) interface{} {
+	switch typ {
+	case "bool":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case "int", "int8", "int16", "int32", "int64":
+		if n, err := strconv.ParseInt(s, 10, 0); err == nil {
+			return int(n)
+		}
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return n
+		}
+	case "float32", "float64":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+
+	return s
+}
+
+// AddStructFlags registers a flag for every key of the struct v, named after the key,
+// e.g. `--logger.level`. Defaults come from the `default=` option of the libra tag, or
+// the values of v; usage comes from the `usage` tag. Arrays of structs and maps, which
+// have no flag type, can be given with --set-json.
+func AddStructFlags(flags *pflag.FlagSet, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() == reflect.Ptr {
+		rv = reflect.New(rv.Type().Elem()).Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("%w: got %T", ErrFlagsTarget, v)
+	}
+
+	addStructFlags(flags, "", rv, map[reflect.Type]bool{})
+
+	return nil
+}
+
+// addStructFlags registers the flags of rv; seen holds the struct types being walked,
+// which recursive types do not walk again.
+func addStructFlags(flags *pflag.FlagSet, prefix string, rv reflect.Value, seen map[reflect.Type]bool) {
+	if seen[rv.Type()] {
+		return
+	}
+
+	seen[rv.Type()] = true
+	defer delete(seen, rv.Type())
+
+	for index := 0; index < rv.NumField(); index++ {
+		field := rv.Type().Field(index)
+		if !isVisibleField(field) {
+			continue
+		}
+
+		key := fieldKey(field)
+		value := rv.Field(index)
+
+		for value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				value = reflect.New(value.Type().Elem())
+			}
+
+			value = value.Elem()
+		}
+
+		switch {
+		case key == "-":
+			continue
+		case key == squashedField:
+			if value.Kind() == reflect.Struct {
+				addStructFlags(flags, prefix, value, seen)
+			}
+
+			continue
+		}
+
+		name := joinPath(prefix, key)
+		if value.Kind() == reflect.Struct && value.Type() != reflect.TypeOf(time.Time{}) {
+			addStructFlags(flags, name, value, seen)
+
+			continue
+		}
+
+		tag := parseFieldTag(field)
+
+		defaultValue, hasDefault := tag.defaultVal, tag.hasDefault
+		if !hasDefault && !value.IsZero() {
+			defaultValue, hasDefault = flagDefault(value.Interface()), true
+		}
+
+		addFlag(flags, name, flagType(value.Type()), field.Tag.Get("usage"), defaultValue, hasDefault)
+	}
+}
+
+// flagType returns the pflag type of values of t, or "" if there is none.
+func flagType(t reflect.Type) string {
+	switch t {
+	case reflect.TypeOf(time.Duration(0)):
+		return "duration"
+	case reflect.TypeOf(ByteSize(0)), reflect.TypeOf(time.Time{}):
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "uint"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		switch t.Elem().Kind() {
+		case reflect.String:
+			return "stringSlice"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return "intSlice"
+		}
+	}
+
+	return ""
+}
+
+// flagDefault formats a value as a flag value.
+func flagDefault(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		items := make([]string, rv.Len())
+		for index := range items {
+			items[index] = fmt.Sprint(rv.Index(index).Interface())
+		}
+
+		return strings.Join(items, ",")
+	}
+
+	return fmt.Sprint(value)
+}
+
+// addFlag registers the flag name of type typ, unless it is registered already.
+func addFlag(flags *pflag.FlagSet, name, typ, usage, defaultValue string, hasDefault bool) {
+	if flags.Lookup(name) != nil {
+		return
+	}
+
+	switch typ {
+	case "bool":
+		flags.Bool(name, false, usage)
+	case "int":
+		flags.Int64(name, 0, usage)
+	case "uint":
+		flags.Uint64(name, 0, usage)
+	case "float":
+		flags.Float64(name, 0, usage)
+	case "duration":
+		flags.Duration(name, 0, usage)
+	case "string":
+		flags.String(name, "", usage)
+	case "stringSlice":
+		flags.StringSlice(name, nil, usage)
+	case "intSlice":
+		flags.IntSlice(name, nil, usage)
+	default:
+		return
+	}
+
+	flag := flags.Lookup(name)
+
+	if hasDefault && flag.Value.Set(defaultValue) == nil {
+		flag.DefValue = flag.Value.String()
+	} else {
+		_ = flags.SetAnnotation(name, noDefaultAnnotation, []string{"true"})
+	}
+}
+
+// AddSchemaFlags registers a flag for every scalar or array of scalars described by the
+// properties of schema, named after its key, e.g. `--logger.level`. Defaults and usage
+// come from the `default` and `description` keywords.
+func AddSchemaFlags(flags *pflag.FlagSet, schema *Schema) {
+	addSchemaFlags(flags, "", schema.schema)
+}
+
+func addSchemaFlags(flags *pflag.FlagSet, prefix string, s *jsonschema.Schema) {
+	for s.Ref != nil {
+		s = s.Ref
+	}
+
+	if len(s.Properties) > 0 {
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			addSchemaFlags(flags, joinPath(prefix, strings.ToLower(name)), s.Properties[name])
+		}
+
+		return
+	}
+
+	if prefix == "" {
+		return
+	}
+
+	typ := schemaFlagType(s)
+	if typ == "" {
+		return
+	}
+
+	usage := s.Description
+	if len(s.Enum) > 0 {
+		values := make([]string, len(s.Enum))
+		for index, value := range s.Enum {
+			values[index] = fmt.Sprint(value)
+		}
+
+		usage = strings.TrimSpace(fmt.Sprintf("%s (one of %s)", usage, strings.Join(values, ", ")))
+	}
+
+	defaultValue := ""
+	if s.Default != nil {
+		defaultValue = flagDefault(s.Default)
+	}
+
+	addFlag(flags, prefix, typ, usage, defaultValue, s.Default != nil)
+}
+
+func schemaFlagType(s *jsonschema.Schema) string {
+	for _, typ := range s.Types {
+		switch typ {
+		case "boolean":
+			return "bool"
+		case "integer":
+			return "int"
+		case "number":
+			return "float"
+		case "string":
+			return "string"
+		case "array":
+			items := s.Items2020
+			if items == nil {
+				items, _ = s.Items.(*jsonschema.Schema)
+			}
+
+			if items == nil {
+				return ""
+			}
+
+			switch schemaFlagType(items) {
+			case "string":
+				return "stringSlice"
+			case "int":
+				return "intSlice"
+			}
+		}
+	}
+
+	return ""
+}
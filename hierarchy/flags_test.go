@@ -0,0 +1,201 @@
+package hierarchy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// loadFlags loads args parsed by a flag set holding the set flags and the flags of add.
+func loadFlags(t *testing.T, h *Hierarchy, args []string, add func(*pflag.FlagSet)) error {
+	t.Helper()
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	AddSetFlags(flags)
+
+	if add != nil {
+		add(flags)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	return h.LoadFlags(flags)
+}
+
+func TestSetFlags(t *testing.T) {
+	cert := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(cert, []byte("-----BEGIN CERTIFICATE-----\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := New()
+	if err := h.LoadAssetMap(map[string][]byte{
+		"app.yaml": []byte("port: 80\nname: web\nlogger: {level: info, format: json}\n"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loadFlags(t, h, []string{
+		`--set=port=8080,name=a\,b,logger.tags={x,y},logger.format=null`,
+		`--set-json=logger.hooks=[{"type":"file"}],logger.size=10`,
+		"--set-file=tls.cert=" + cert,
+		"--set=logger.level=debug",
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]interface{}{
+		"port":         8080,
+		"name":         "a,b",
+		"logger.tags":  []interface{}{"x", "y"},
+		"logger.hooks": []interface{}{map[string]interface{}{"type": "file"}},
+		"logger.size":  float64(10),
+		"logger.level": "debug",
+		"tls.cert":     "-----BEGIN CERTIFICATE-----\n",
+	}
+	for key, want := range tests {
+		if got := h.Get(key); !reflect.DeepEqual(got, want) {
+			t.Errorf("Get(%s) = %#v, want %#v", key, got, want)
+		}
+	}
+
+	if h.IsSet("logger.format") {
+		t.Error("--set logger.format=null did not delete the key")
+	}
+}
+
+func TestSetFlagErrors(t *testing.T) {
+	tests := map[string]string{
+		"missing equal":        "--set=db.password",
+		"trailing JSON":        `--set-json=db.password="s3cret" x`,
+		"invalid JSON":         "--set-json=db.password=s3cret",
+		"missing file":         "--set-file=db.password=missing.txt",
+		"not the existing int": "--set=db.port=s3cret",
+	}
+
+	for name, arg := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := New()
+			h.SetDefault("db.port", 5432)
+
+			err := loadFlags(t, h, []string{arg}, nil)
+			if !errors.Is(err, ErrInvalidSet) {
+				t.Fatalf("LoadFlags(%s) = %v, want ErrInvalidSet", arg, err)
+			}
+
+			if strings.Contains(err.Error(), "s3cret") {
+				t.Errorf("LoadFlags(%s) = %v, which holds the value", arg, err)
+			}
+		})
+	}
+}
+
+type flagsConfig struct {
+	Name    string        `libra:"name" usage:"name of the service"`
+	Timeout time.Duration `libra:"timeout,default=5s"`
+	Logger  struct {
+		Level string   `libra:"level"`
+		Tags  []string `libra:"tags"`
+	} `libra:"logger"`
+	Hooks []struct {
+		Type string `libra:"type"`
+	} `libra:"hooks"`
+	Skipped string `libra:"-"`
+}
+
+func TestAddStructFlags(t *testing.T) {
+	config := flagsConfig{Name: "api"}
+
+	var flags *pflag.FlagSet
+
+	h := New()
+	if err := loadFlags(t, h, []string{"--logger.level=debug"}, func(f *pflag.FlagSet) {
+		flags = f
+
+		if err := AddStructFlags(f, &config); err != nil {
+			t.Fatal(err)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, usage := range map[string]string{"name": "name of the service", "timeout": "", "logger.level": "", "logger.tags": ""} {
+		if flag := flags.Lookup(name); flag == nil {
+			t.Errorf("flag --%s is missing", name)
+		} else if flag.Usage != usage {
+			t.Errorf("flag --%s usage = %q, want %q", name, flag.Usage, usage)
+		}
+	}
+
+	for _, name := range []string{"hooks", "skipped", "Skipped"} {
+		if flags.Lookup(name) != nil {
+			t.Errorf("flag --%s is registered", name)
+		}
+	}
+
+	tests := map[string]interface{}{"name": "api", "timeout": "5s", "logger.level": "debug"}
+	for key, want := range tests {
+		if got := h.Get(key); got != want {
+			t.Errorf("Get(%s) = %#v, want %#v", key, got, want)
+		}
+	}
+
+	// Flags without a default only override keys when given.
+	if h.IsSet("logger.tags") {
+		t.Error("logger.tags is set by a flag that was not given")
+	}
+
+	if err := AddStructFlags(flags, "config"); !errors.Is(err, ErrFlagsTarget) {
+		t.Errorf("AddStructFlags(string) = %v, want ErrFlagsTarget", err)
+	}
+}
+
+func TestAddSchemaFlags(t *testing.T) {
+	schema, err := CompileSchema("server.yaml", []byte(`
+type: object
+properties:
+  name: {type: string, description: name of the service}
+  port: {type: integer, default: 8080}
+  tags: {type: array, items: {type: string}}
+  tls:
+    type: object
+    properties:
+      enabled: {type: boolean}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var flags *pflag.FlagSet
+
+	h := New()
+	if err := loadFlags(t, h, []string{"--tls.enabled", "--tags=a,b"}, func(f *pflag.FlagSet) {
+		flags = f
+		AddSchemaFlags(f, schema)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if flag := flags.Lookup("name"); flag == nil || flag.Usage != "name of the service" {
+		t.Errorf("flag --name = %+v, want the description as usage", flag)
+	}
+
+	tests := map[string]interface{}{"port": 8080, "tls.enabled": true, "tags": []interface{}{"a", "b"}}
+	for key, want := range tests {
+		if got := h.Get(key); !reflect.DeepEqual(got, want) {
+			t.Errorf("Get(%s) = %#v, want %#v", key, got, want)
+		}
+	}
+
+	if h.IsSet("name") {
+		t.Error("name is set by a flag that was not given")
+	}
+}
@@ -0,0 +1,413 @@
+package hierarchy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const hierarchyImport = "github.com/cloudlibraries/libra/hierarchy"
+
+var ErrInvalidField = errors.New("key cannot name a struct field")
+
+var (
+	identifierExp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// fieldKeyExp matches the keys named by a struct field, e.g. `chat_id`, `max-size` or `2fa`.
+	fieldKeyExp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_-]*$`)
+	// durationExp matches durations with units only, so that plain numbers stay numbers.
+	durationExp = regexp.MustCompile(`^-?([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$`)
+	byteSizeExp = regexp.MustCompile(`(?i)^[0-9]+(\.[0-9]+)?\s*(b|[kmgtp]i?b)$`)
+	initialisms = map[string]string{
+		"api": "API", "db": "DB", "dns": "DNS", "http": "HTTP", "https": "HTTPS", "id": "ID",
+		"ip": "IP", "json": "JSON", "sql": "SQL", "ssh": "SSH", "tcp": "TCP", "tls": "TLS",
+		"ttl": "TTL", "udp": "UDP", "uri": "URI", "url": "URL", "uuid": "UUID", "xml": "XML",
+	}
+)
+
+type genKind int
+
+const (
+	genAny genKind = iota
+	genScalar
+	genStruct
+	genMap
+	genSlice
+)
+
+// genType is a Go type inferred from settings.
+type genType struct {
+	kind genKind
+	// scalar is the Go type of a scalar, e.g. "time.Duration".
+	scalar string
+	fields []*genField
+	elem   *genType
+	// name is the name of a struct type, set once every type is inferred.
+	name string
+}
+
+type genField struct {
+	key string
+	typ *genType
+}
+
+// inferType infers the Go type of value. Maps whose keys can all name fields, see
+// fieldKeyExp, become structs; other maps, such as routes by path, become Go maps.
+func inferType(value interface{}) *genType {
+	switch v := value.(type) {
+	case nil:
+		return &genType{kind: genAny}
+	case bool:
+		return &genType{kind: genScalar, scalar: "bool"}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return &genType{kind: genScalar, scalar: "int"}
+	case float32, float64:
+		return &genType{kind: genScalar, scalar: "float64"}
+	case time.Duration:
+		return &genType{kind: genScalar, scalar: "time.Duration"}
+	case time.Time:
+		return &genType{kind: genScalar, scalar: "time.Time"}
+	case string:
+		return &genType{kind: genScalar, scalar: inferStringType(v)}
+	case []interface{}:
+		elem := &genType{kind: genAny}
+		for index, item := range v {
+			if index == 0 {
+				elem = inferType(item)
+			} else {
+				elem = unifyTypes(elem, inferType(item))
+			}
+		}
+
+		return &genType{kind: genSlice, elem: elem}
+	case map[string]interface{}:
+		return inferMapType(v)
+	default:
+		return &genType{kind: genAny}
+	}
+}
+
+func inferStringType(s string) string {
+	switch {
+	case durationExp.MatchString(s):
+		return "time.Duration"
+	case byteSizeExp.MatchString(s):
+		return "hierarchy.ByteSize"
+	}
+
+	if _, err := time.Parse(time.RFC3339, s); err == nil {
+		return "time.Time"
+	}
+
+	return "string"
+}
+
+func inferMapType(m map[string]interface{}) *genType {
+	keys := make([]string, 0, len(m))
+	isStruct := len(m) > 0
+
+	for key := range m {
+		keys = append(keys, key)
+		isStruct = isStruct && fieldKeyExp.MatchString(key)
+	}
+
+	sort.Strings(keys)
+
+	if !isStruct {
+		elem := &genType{kind: genAny}
+		for index, key := range keys {
+			if index == 0 {
+				elem = inferType(m[key])
+			} else {
+				elem = unifyTypes(elem, inferType(m[key]))
+			}
+		}
+
+		return &genType{kind: genMap, elem: elem}
+	}
+
+	t := &genType{kind: genStruct}
+	for _, key := range keys {
+		t.fields = append(t.fields, &genField{key: key, typ: inferType(m[key])})
+	}
+
+	return t
+}
+
+// unifyTypes returns a type holding values of both a and b, e.g. the union of the
+// fields of two structs, float64 for int and float64, or interface{}.
+func unifyTypes(a, b *genType) *genType {
+	switch {
+	case a.kind == genAny && a.scalar == "" && a.elem == nil && a.fields == nil:
+		return b
+	case b.kind == genAny:
+		return a
+	case a.kind != b.kind:
+		return &genType{kind: genAny}
+	}
+
+	switch a.kind {
+	case genScalar:
+		switch {
+		case a.scalar == b.scalar:
+			return a
+		case a.scalar == "int" && b.scalar == "float64", a.scalar == "float64" && b.scalar == "int":
+			return &genType{kind: genScalar, scalar: "float64"}
+		default:
+			// Durations, sizes and times are strings that happened to parse.
+			return &genType{kind: genScalar, scalar: "string"}
+		}
+	case genStruct:
+		fields := make(map[string]*genField, len(a.fields))
+		for _, f := range a.fields {
+			fields[f.key] = f
+		}
+
+		t := &genType{kind: genStruct, fields: append([]*genField{}, a.fields...)}
+
+		for _, f := range b.fields {
+			if existing, ok := fields[f.key]; ok {
+				existing.typ = unifyTypes(existing.typ, f.typ)
+			} else {
+				t.fields = append(t.fields, f)
+			}
+		}
+
+		sort.Slice(t.fields, func(i, j int) bool {
+			return t.fields[i].key < t.fields[j].key
+		})
+
+		return t
+	default:
+		return &genType{kind: a.kind, elem: unifyTypes(a.elem, b.elem)}
+	}
+}
+
+// goName converts a key such as `chat_id` or `max-size` into an exported Go name.
+func goName(key string) string {
+	var name strings.Builder
+
+	parts := strings.FieldsFunc(key, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, part := range parts {
+		if initialism, ok := initialisms[strings.ToLower(part)]; ok {
+			name.WriteString(initialism)
+
+			continue
+		}
+
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		name.WriteString(string(runes))
+	}
+
+	s := name.String()
+	if s == "" || unicode.IsDigit([]rune(s)[0]) {
+		s = "X" + s
+	}
+
+	return s
+}
+
+// singular guesses the singular of a plural name, for the type of array items.
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies") && len(name) > 3:
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(name, "ses"), strings.HasSuffix(name, "xes"):
+		return name[:len(name)-2]
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss") && len(name) > 1:
+		return name[:len(name)-1]
+	default:
+		return name + "Item"
+	}
+}
+
+// structGen names and writes the struct types of a type tree.
+type structGen struct {
+	names   map[string]bool
+	structs []*genType
+	imports map[string]bool
+}
+
+func (g *structGen) name(t *genType, name string) {
+	switch t.kind {
+	case genStruct:
+		unique := name
+		for index := 2; g.names[unique]; index++ {
+			unique = fmt.Sprintf("%s%d", name, index)
+		}
+
+		g.names[unique] = true
+		t.name = unique
+		g.structs = append(g.structs, t)
+
+		for _, f := range t.fields {
+			g.name(f.typ, goName(f.key))
+		}
+	case genSlice:
+		g.name(t.elem, singular(name))
+	case genMap:
+		g.name(t.elem, name+"Value")
+	}
+}
+
+func (g *structGen) goType(t *genType) string {
+	switch t.kind {
+	case genScalar:
+		if pkg, _, ok := strings.Cut(t.scalar, "."); ok {
+			if pkg == "hierarchy" {
+				g.imports[hierarchyImport] = true
+			} else {
+				g.imports[pkg] = true
+			}
+		}
+
+		return t.scalar
+	case genStruct:
+		return t.name
+	case genSlice:
+		return "[]" + g.goType(t.elem)
+	case genMap:
+		return "map[string]" + g.goType(t.elem)
+	default:
+		return "interface{}"
+	}
+}
+
+// GenerateStructs returns the Go source of struct types mirroring settings, with tags read
+// by Decode and Unmarshal holding the original keys. Durations, byte sizes, times, arrays
+// of objects and maps that are data rather than structure, such as routes by path, are
+// inferred from the values. A key of settings that cannot name a field is ErrInvalidField.
+func GenerateStructs(settings map[string]interface{}, pkg, typeName string) ([]byte, error) {
+	root := inferMapType(settings)
+	if root.kind != genStruct {
+		keys := make([]string, 0)
+
+		for key := range settings {
+			if !fieldKeyExp.MatchString(key) {
+				keys = append(keys, strconv.Quote(key))
+			}
+		}
+
+		if len(keys) > 0 {
+			sort.Strings(keys)
+
+			return nil, fmt.Errorf("%w: %s", ErrInvalidField, strings.Join(keys, ", "))
+		}
+
+		root = &genType{kind: genStruct}
+	}
+
+	g := &structGen{names: make(map[string]bool), imports: make(map[string]bool)}
+	g.name(root, typeName)
+
+	var body bytes.Buffer
+
+	for _, t := range g.structs {
+		fmt.Fprintf(&body, "\ntype %s struct {\n", t.name)
+
+		names := make(map[string]bool, len(t.fields))
+
+		for _, f := range t.fields {
+			name := goName(f.key)
+			for index := 2; names[name]; index++ {
+				name = fmt.Sprintf("%s%d", goName(f.key), index)
+			}
+
+			names[name] = true
+			fmt.Fprintf(&body, "\t%s %s `libra:%q mapstructure:%q`\n", name, g.goType(f.typ), f.key, f.key)
+		}
+
+		body.WriteString("}\n")
+	}
+
+	var src bytes.Buffer
+
+	fmt.Fprintf(&src, "// Code generated by libra config gen. DO NOT EDIT.\n\npackage %s\n", pkg)
+
+	if len(g.imports) > 0 {
+		imports := make([]string, 0, len(g.imports))
+		for path := range g.imports {
+			imports = append(imports, path)
+		}
+
+		// Standard packages, having no dot, sort before the hierarchy package.
+		sort.Slice(imports, func(i, j int) bool {
+			iStd, jStd := !strings.Contains(imports[i], "."), !strings.Contains(imports[j], ".")
+			if iStd != jStd {
+				return iStd
+			}
+
+			return imports[i] < imports[j]
+		})
+		src.WriteString("\nimport (\n")
+
+		for index, path := range imports {
+			if index > 0 && strings.Contains(path, ".") && !strings.Contains(imports[index-1], ".") {
+				src.WriteString("\n")
+			}
+
+			fmt.Fprintf(&src, "\t%q\n", path)
+		}
+
+		src.WriteString(")\n")
+	}
+
+	src.Write(body.Bytes())
+
+	return format.Source(src.Bytes())
+}
+
+// GenerateSchema returns a JSON Schema, draft 2020-12, describing the types inferred from
+// settings like GenerateStructs does.
+func GenerateSchema(settings map[string]interface{}) ([]byte, error) {
+	schema := typeSchema(inferMapType(settings))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func typeSchema(t *genType) map[string]interface{} {
+	switch t.kind {
+	case genScalar:
+		switch t.scalar {
+		case "bool":
+			return map[string]interface{}{"type": "boolean"}
+		case "int":
+			return map[string]interface{}{"type": "integer"}
+		case "float64":
+			return map[string]interface{}{"type": "number"}
+		case "time.Duration":
+			return map[string]interface{}{"type": "string", "pattern": durationExp.String()}
+		case "hierarchy.ByteSize":
+			return map[string]interface{}{"type": []string{"string", "integer"}, "pattern": byteSizeExp.String()}
+		case "time.Time":
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		default:
+			return map[string]interface{}{"type": "string"}
+		}
+	case genStruct:
+		properties := make(map[string]interface{}, len(t.fields))
+		for _, f := range t.fields {
+			properties[f.key] = typeSchema(f.typ)
+		}
+
+		return map[string]interface{}{"type": "object", "properties": properties}
+	case genMap:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.elem)}
+	case genSlice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.elem)}
+	default:
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,79 @@
+package hierarchy
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateStructs(t *testing.T) {
+	settings := map[string]interface{}{
+		"timeout":        "1.5s",
+		"max-size":       "10MB",
+		"2fa":            true,
+		"started":        "2024-01-02T03:04:05Z",
+		"list-of-things": []interface{}{map[string]interface{}{"name": "a", "ttl": 1}, map[string]interface{}{"name": "b", "ratio": 0.5}},
+		"routes":         map[string]interface{}{"/api": "api", "/": "web"},
+	}
+
+	src, err := GenerateStructs(settings, "config", "Config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "// Code generated by libra config gen. DO NOT EDIT.\n\npackage config\n\nimport (\n\t\"time\"\n\n" +
+		"\t\"github.com/cloudlibraries/libra/hierarchy\"\n)\n\ntype Config struct {\n" +
+		"\tX2fa         bool               `libra:\"2fa\" mapstructure:\"2fa\"`\n" +
+		"\tListOfThings []ListOfThing      `libra:\"list-of-things\" mapstructure:\"list-of-things\"`\n" +
+		"\tMaxSize      hierarchy.ByteSize `libra:\"max-size\" mapstructure:\"max-size\"`\n" +
+		"\tRoutes       map[string]string  `libra:\"routes\" mapstructure:\"routes\"`\n" +
+		"\tStarted      time.Time          `libra:\"started\" mapstructure:\"started\"`\n" +
+		"\tTimeout      time.Duration      `libra:\"timeout\" mapstructure:\"timeout\"`\n}\n\n" +
+		"type ListOfThing struct {\n" +
+		"\tName  string  `libra:\"name\" mapstructure:\"name\"`\n" +
+		"\tRatio float64 `libra:\"ratio\" mapstructure:\"ratio\"`\n" +
+		"\tTTL   int     `libra:\"ttl\" mapstructure:\"ttl\"`\n}\n"
+	if string(src) != want {
+		t.Errorf("GenerateStructs =\n%s\nwant\n%s", src, want)
+	}
+
+	_, err = GenerateStructs(map[string]interface{}{"name": "api", "/health": true}, "config", "Config")
+	if !errors.Is(err, ErrInvalidField) || !strings.Contains(err.Error(), `"/health"`) {
+		t.Errorf("GenerateStructs with a path key error = %v, want %v naming it", err, ErrInvalidField)
+	}
+
+	if _, err := GenerateStructs(map[string]interface{}{}, "config", "Config"); err != nil {
+		t.Errorf("GenerateStructs of no settings error = %v", err)
+	}
+}
+
+func TestGenerateSchema(t *testing.T) {
+	data, err := GenerateSchema(map[string]interface{}{
+		"port":    8080,
+		"timeout": "5s",
+		"headers": map[string]interface{}{"X-Request-Id": "1", "/": "2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema struct {
+		Properties map[string]map[string]interface{}
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	if typ := schema.Properties["port"]["type"]; typ != "integer" {
+		t.Errorf("port type = %v, want integer", typ)
+	}
+
+	if _, ok := schema.Properties["timeout"]["pattern"]; !ok {
+		t.Errorf("timeout = %v, want a duration pattern", schema.Properties["timeout"])
+	}
+
+	if _, ok := schema.Properties["headers"]["additionalProperties"]; !ok {
+		t.Errorf("headers = %v, want a map", schema.Properties["headers"])
+	}
+}
@@ -0,0 +1,93 @@
+package hierarchy
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrKeyNotSet = errors.New("key not set")
+
+type getOptions[T any] struct {
+	defaultValue T
+	hasDefault   bool
+}
+
+// GetOption configures GetAs, Try and Must.
+type GetOption[T any] func(*getOptions[T])
+
+// WithDefault sets the value returned when the key is not set.
+func WithDefault[T any](value T) GetOption[T] {
+	return func(o *getOptions[T]) {
+		o.defaultValue = value
+		o.hasDefault = true
+	}
+}
+
+// Lookup returns the value of key converted to T and whether the key is set.
+// Unlike the viper getters, a value that cannot be converted is an error rather than a zero.
+func Lookup[T any](h *Hierarchy, key string) (T, bool, error) {
+	var value T
+
+	if !h.IsSet(key) {
+		return value, false, nil
+	}
+
+	raw := h.Get(key)
+	if raw == nil {
+		return value, false, nil
+	}
+
+	var converted T
+	if err := decode(raw, &converted); err != nil {
+		return value, true, fmt.Errorf("%s: %w", key, err)
+	}
+
+	return converted, true, nil
+}
+
+// Try returns the value of key, the default if the key is not set,
+// or an error if the value cannot be converted or the key is not set and has no default.
+func Try[T any](h *Hierarchy, key string, opts ...GetOption[T]) (T, error) {
+	o := &getOptions[T]{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	value, ok, err := Lookup[T](h, key)
+
+	switch {
+	case err != nil:
+		return o.defaultValue, err
+	case ok:
+		return value, nil
+	case o.hasDefault:
+		return o.defaultValue, nil
+	default:
+		return value, fmt.Errorf("%w: %s", ErrKeyNotSet, key)
+	}
+}
+
+// GetAs returns the value of key, falling back to the default when it is not set or cannot be converted.
+func GetAs[T any](h *Hierarchy, key string, opts ...GetOption[T]) T {
+	o := &getOptions[T]{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	value, ok, err := Lookup[T](h, key)
+	if err != nil || !ok {
+		return o.defaultValue
+	}
+
+	return value
+}
+
+// Must is like Try but panics on error.
+func Must[T any](h *Hierarchy, key string, opts ...GetOption[T]) T {
+	value, err := Try(h, key, opts...)
+	if err != nil {
+		panic(err)
+	}
+
+	return value
+}
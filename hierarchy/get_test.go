@@ -0,0 +1,64 @@
+package hierarchy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTry(t *testing.T) {
+	h := New()
+	h.Set("ratio", 1.5)
+	h.Set("octal", "010")
+	h.Set("count", "42")
+	h.Set("whole", 3.0)
+	h.Set("compress", false)
+
+	if _, err := Try[int](h, "ratio"); !errors.Is(err, ErrConvertFailed) {
+		t.Errorf("Try[int](1.5) error = %v, want ErrConvertFailed", err)
+	}
+
+	if _, err := Try[int](h, "octal"); !errors.Is(err, ErrConvertFailed) {
+		t.Errorf(`Try[int]("010") error = %v, want ErrConvertFailed`, err)
+	}
+
+	if n, err := Try[int](h, "count"); err != nil || n != 42 {
+		t.Errorf(`Try[int]("42") = %d, %v, want 42`, n, err)
+	}
+
+	if n, err := Try[int](h, "whole"); err != nil || n != 3 {
+		t.Errorf("Try[int](3.0) = %d, %v, want 3", n, err)
+	}
+
+	if _, err := Try[string](h, "missing"); !errors.Is(err, ErrKeyNotSet) {
+		t.Errorf("Try(missing) error = %v, want ErrKeyNotSet", err)
+	}
+
+	if b := GetAs(h, "compress", WithDefault(true)); b {
+		t.Error("GetAs replaced an explicit false by the default")
+	}
+}
+
+func TestGetStringMapVal(t *testing.T) {
+	h := New()
+	h.Set("empty", map[string]interface{}{})
+
+	defaultValue := map[string]interface{}{"a": 1}
+	if m := h.GetStringMapVal("empty", defaultValue); len(m) != 0 {
+		t.Errorf("GetStringMapVal(empty) = %v, want the empty map", m)
+	}
+
+	if m := h.GetStringMapVal("missing", defaultValue); len(m) != 1 {
+		t.Errorf("GetStringMapVal(missing) = %v, want the default", m)
+	}
+}
+
+func TestGet(t *testing.T) {
+	defer func(h *Hierarchy) { _default = h }(_default)
+
+	_default = New()
+	Set("name", "libra")
+
+	if v := Get("name"); v != "libra" {
+		t.Errorf("Get(name) = %v, want libra", v)
+	}
+}
@@ -5,25 +5,64 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
-	"github.com/tidwall/gjson"
 )
 
 var ErrHierachyShouldBeMap = errors.New("hierarchy should be map")
 
+// Hierarchy is safe for concurrent use, apart from the config reading of its embedded
+// viper: reads go lock-free against the current layers and the tree merged from them,
+// which writes replace atomically, so that reads cost a lookup along the key.
 type Hierarchy struct {
 	*viper.Viper
-}
+	current atomic.Pointer[layers]
+	// mu serializes writes and guards the fields below.
+	mu       sync.Mutex
+	profiles []string
+	// declaredProfiles are the patterns of DeclareProfiles.
+	declaredProfiles []string
+	mergeStrategies  map[string]MergeStrategy
+	schemas          map[string]*Schema
+	envPrefix        string
+	// envBindings maps the keys bound with BindEnv to their env vars.
+	envBindings   map[string][]string
+	configChange  func(fsnotify.Event)
+	subscriptions []*subscription
+	preserveCase  bool
+	// sensitiveKeys are the patterns of MarkSensitive, DefaultSensitiveKeys when nil.
+	sensitiveKeys []string
+	// root and prefix are set on views returned by Sub, which hold no layer themselves.
+	root   *Hierarchy
+	prefix string
+}
+
+// Option configures New.
+type Option func(*Hierarchy)
+
+func New(opts ...Option) *Hierarchy {
+	h := &Hierarchy{
+		Viper:           viper.New(),
+		mergeStrategies: make(map[string]MergeStrategy),
+		schemas:         make(map[string]*Schema),
+	}
+	h.current.Store(newLayers())
+
+	for _, opt := range opts {
+		opt(h)
+	}
 
-func New() *Hierarchy {
-	return &Hierarchy{viper.New()}
+	return h
 }
 
 var _default = New()
 
+// String dumps the resolved settings as JSON, with sensitive values redacted.
 func (h *Hierarchy) String() string {
 	data, err := h.JSONIndent()
 	if err != nil {
@@ -37,28 +76,81 @@ func Sub(key string) *Hierarchy {
 	return _default.Sub(key)
 }
 
+// Sub returns a live view of the subtree at key. Reads, writes and subscriptions of
+// the view go to h, so it sees every later Set or reload. See Snapshot for a copy.
 func (h *Hierarchy) Sub(key string) *Hierarchy {
-	v := h.Viper.Sub(key)
-	if v == nil {
-		return &Hierarchy{viper.New()}
+	return &Hierarchy{
+		Viper:  viper.New(),
+		root:   h.base(),
+		prefix: strings.ToLower(h.absolute(key)),
+	}
+}
+
+func Snapshot(key string) *Hierarchy {
+	return _default.Snapshot(key)
+}
+
+// Snapshot returns a detached copy of the resolved subtree at key, or of the whole
+// hierarchy if key is empty. Later changes of h are not seen by the copy.
+func (h *Hierarchy) Snapshot(key string) *Hierarchy {
+	m, _ := h.Get(key).(map[string]interface{})
+
+	return h.detached(m)
+}
+
+// detached returns a new hierarchy holding settings, preserving case like h.
+func (h *Hierarchy) detached(settings map[string]interface{}) *Hierarchy {
+	d := New()
+	d.preserveCase = h.base().preserveCase
+	d.hold(settings)
+
+	return d
+}
+
+// hold sets the config layer of h, which must be new, to settings.
+func (h *Hierarchy) hold(settings map[string]interface{}) {
+	l := h.current.Load()
+	config, _ := insensitivise(settings).(map[string]interface{})
+	mergeTree(l.config, config, false)
+	l.recordCases("", settings)
+	l.tree = h.treeOf(l)
+}
+
+// base returns the hierarchy holding the layers, which is the root of a view.
+func (h *Hierarchy) base() *Hierarchy {
+	if h.root != nil {
+		return h.root
+	}
+
+	return h
+}
+
+// absolute returns key relative to the root of a view.
+func (h *Hierarchy) absolute(key string) string {
+	if key == "" {
+		return h.prefix
 	}
-	return &Hierarchy{v}
+
+	return joinPath(h.prefix, key)
 }
 
 func JSON() ([]byte, error) {
 	return _default.JSON()
 }
 
+// JSON encodes the resolved settings, with sensitive values redacted, see Redacted.
+// Export encodes them as they are.
 func (h *Hierarchy) JSON() ([]byte, error) {
-	return json.Marshal(h.AllSettings())
+	return json.Marshal(h.Redacted())
 }
 
 func JSONIndent() ([]byte, error) {
 	return _default.JSONIndent()
 }
 
+// JSONIndent is like JSON, indented.
 func (h *Hierarchy) JSONIndent() ([]byte, error) {
-	return json.MarshalIndent(h.AllSettings(), "", "  ")
+	return json.MarshalIndent(h.Redacted(), "", "  ")
 }
 
 func IsArray(key string) bool {
@@ -66,12 +158,9 @@ func IsArray(key string) bool {
 }
 
 func (h *Hierarchy) IsArray(key string) bool {
-	data, err := h.JSON()
-	if err != nil {
-		return false
-	}
+	_, ok := h.Get(key).([]interface{})
 
-	return gjson.Get(string(data), key).IsArray()
+	return ok
 }
 
 func IsMap(key string) bool {
@@ -79,12 +168,9 @@ func IsMap(key string) bool {
 }
 
 func (h *Hierarchy) IsMap(key string) bool {
-	data, err := h.JSON()
-	if err != nil {
-		return false
-	}
+	_, ok := h.Get(key).(map[string]interface{})
 
-	return gjson.Get(string(data), key).IsObject()
+	return ok
 }
 
 func ChildrenInArray(key string) ([]*Hierarchy, error) {
@@ -92,18 +178,13 @@ func ChildrenInArray(key string) ([]*Hierarchy, error) {
 }
 
 func (h *Hierarchy) ChildrenInArray(key string) ([]*Hierarchy, error) {
-	data, err := h.JSON()
-	if err != nil {
-		return nil, err
-	}
-
 	children := make([]*Hierarchy, 0)
-	node := gjson.Get(string(data), key)
 
-	if node.IsArray() {
-		for index, child := range node.Array() {
+	switch node := h.Get(key).(type) {
+	case []interface{}:
+		for index, child := range node {
 			childKey := fmt.Sprintf("%s.%d", key, index)
-			if child.IsArray() {
+			if _, ok := child.([]interface{}); ok {
 				return nil, fmt.Errorf("%w: %s", ErrHierachyShouldBeMap, childKey)
 			}
 
@@ -111,12 +192,10 @@ func (h *Hierarchy) ChildrenInArray(key string) ([]*Hierarchy, error) {
 		}
 
 		return children, nil
-	}
-
-	if node.IsObject() {
-		for nodeKey, child := range node.Map() {
+	case map[string]interface{}:
+		for nodeKey, child := range node {
 			childKey := fmt.Sprintf("%s.%s", key, nodeKey)
-			if child.IsArray() {
+			if _, ok := child.([]interface{}); ok {
 				return nil, fmt.Errorf("%w: %s", ErrHierachyShouldBeMap, childKey)
 			}
 
@@ -134,18 +213,13 @@ func ChildrenInMap(key string) (map[string]*Hierarchy, error) {
 }
 
 func (h *Hierarchy) ChildrenInMap(key string) (map[string]*Hierarchy, error) {
-	data, err := h.JSON()
-	if err != nil {
-		return nil, err
-	}
-
 	children := make(map[string]*Hierarchy)
 
-	node := gjson.Get(string(data), key)
-	if node.IsArray() {
-		for index, child := range node.Array() {
+	switch node := h.Get(key).(type) {
+	case []interface{}:
+		for index, child := range node {
 			childKey := fmt.Sprintf("%s.%d", key, index)
-			if child.IsArray() {
+			if _, ok := child.([]interface{}); ok {
 				return nil, fmt.Errorf("%w: %s", ErrHierachyShouldBeMap, childKey)
 			}
 
@@ -153,12 +227,10 @@ func (h *Hierarchy) ChildrenInMap(key string) (map[string]*Hierarchy, error) {
 		}
 
 		return children, nil
-	}
-
-	if node.IsObject() {
-		for nodeKey, child := range node.Map() {
+	case map[string]interface{}:
+		for nodeKey, child := range node {
 			childKey := fmt.Sprintf("%s.%s", key, nodeKey)
-			if child.IsArray() {
+			if _, ok := child.([]interface{}); ok {
 				return nil, fmt.Errorf("%w: %s", ErrHierachyShouldBeMap, childKey)
 			}
 
@@ -213,27 +285,12 @@ func (h *Hierarchy) ForeachInMap(key string, fn func(key string, child *Hierarch
 	return nil
 }
 
-// varExp gets var from ${var}.
-var varExp = regexp.MustCompile(`\$\{([a-zA-Z0-9_]+)\}`)
-
-func (h *Hierarchy) ReplaceAllVars(data []byte) []byte {
-	// replace all vars
-	return varExp.ReplaceAllFunc(data, func(match []byte) []byte {
-		key := string(match[2 : len(match)-1])
-		return []byte(h.GetString(key))
-	})
-}
-
 func GetIntVal(key string, defaultValue int) int {
 	return _default.GetIntVal(key, defaultValue)
 }
 
 func (h *Hierarchy) GetIntVal(key string, defaultValue int) int {
-	v := h.GetInt(key)
-	if v == 0 {
-		return defaultValue
-	}
-	return v
+	return GetAs(h, key, WithDefault(defaultValue))
 }
 
 func GetInt32Val(key string, defaultValue int32) int32 {
@@ -241,11 +298,7 @@ func GetInt32Val(key string, defaultValue int32) int32 {
 }
 
 func (h *Hierarchy) GetInt32Val(key string, defaultValue int32) int32 {
-	v := h.GetInt32(key)
-	if v == 0 {
-		return defaultValue
-	}
-	return v
+	return GetAs(h, key, WithDefault(defaultValue))
 }
 
 func GetInt64Val(key string, defaultValue int64) int64 {
@@ -253,11 +306,7 @@ func GetInt64Val(key string, defaultValue int64) int64 {
 }
 
 func (h *Hierarchy) GetInt64Val(key string, defaultValue int64) int64 {
-	v := h.GetInt64(key)
-	if v == 0 {
-		return defaultValue
-	}
-	return v
+	return GetAs(h, key, WithDefault(defaultValue))
 }
 
 func GetUintVal(key string, defaultValue uint) uint {
@@ -265,11 +314,7 @@ func GetUintVal(key string, defaultValue uint) uint {
 }
 
 func (h *Hierarchy) GetUintVal(key string, defaultValue uint) uint {
-	v := h.GetUint(key)
-	if v == 0 {
-		return defaultValue
-	}
-	return v
+	return GetAs(h, key, WithDefault(defaultValue))
 }
 
 func GetUint32Val(key string, defaultValue uint32) uint32 {
@@ -277,11 +322,7 @@ func GetUint32Val(key string, defaultValue uint32) uint32 {
 }
 
 func (h *Hierarchy) GetUint32Val(key string, defaultValue uint32) uint32 {
-	v := h.GetUint32(key)
-	if v == 0 {
-		return defaultValue
-	}
-	return v
+	return GetAs(h, key, WithDefault(defaultValue))
 }
 
 func GetUint64Val(key string, defaultValue uint64) uint64 {
@@ -289,11 +330,7 @@ func GetUint64Val(key string, defaultValue uint64) uint64 {
 }
 
 func (h *Hierarchy) GetUint64Val(key string, defaultValue uint64) uint64 {
-	v := h.GetUint64(key)
-	if v == 0 {
-		return defaultValue
-	}
-	return v
+	return GetAs(h, key, WithDefault(defaultValue))
 }
 
 func GetFloat64Val(key string, defaultValue float64) float64 {
@@ -301,11 +338,7 @@ func GetFloat64Val(key string, defaultValue float64) float64 {
 }
 
 func (h *Hierarchy) GetFloat64Val(key string, defaultValue float64) float64 {
-	v := h.GetFloat64(key)
-	if v == 0 {
-		return defaultValue
-	}
-	return v
+	return GetAs(h, key, WithDefault(defaultValue))
 }
 
 func GetBoolVal(key string, defaultValue bool) bool {
@@ -313,11 +346,7 @@ func GetBoolVal(key string, defaultValue bool) bool {
 }
 
 func (h *Hierarchy) GetBoolVal(key string, defaultValue bool) bool {
-	v := h.GetBool(key)
-	if !v {
-		return defaultValue
-	}
-	return v
+	return GetAs(h, key, WithDefault(defaultValue))
 }
 
 func GetStringVal(key string, defaultValue string) string {
@@ -325,11 +354,7 @@ func GetStringVal(key string, defaultValue string) string {
 }
 
 func (h *Hierarchy) GetStringVal(key string, defaultValue string) string {
-	v := h.GetString(key)
-	if v == "" {
-		return defaultValue
-	}
-	return v
+	return GetAs(h, key, WithDefault(defaultValue))
 }
 
 func GetDurationVal(key string, defaultValue time.Duration) time.Duration {
@@ -337,11 +362,7 @@ func GetDurationVal(key string, defaultValue time.Duration) time.Duration {
 }
 
 func (h *Hierarchy) GetDurationVal(key string, defaultValue time.Duration) time.Duration {
-	v := h.GetDuration(key)
-	if v == 0 {
-		return defaultValue
-	}
-	return v
+	return GetAs(h, key, WithDefault(defaultValue))
 }
 
 func GetTimeVal(key string, defaultValue time.Time) time.Time {
@@ -349,11 +370,7 @@ func GetTimeVal(key string, defaultValue time.Time) time.Time {
 }
 
 func (h *Hierarchy) GetTimeVal(key string, defaultValue time.Time) time.Time {
-	v := h.GetTime(key)
-	if v.IsZero() {
-		return defaultValue
-	}
-	return v
+	return GetAs(h, key, WithDefault(defaultValue))
 }
 
 func GetIntSliceVal(key string, defaultValue []int) []int {
@@ -361,11 +378,7 @@ func GetIntSliceVal(key string, defaultValue []int) []int {
 }
 
 func (h *Hierarchy) GetIntSliceVal(key string, defaultValue []int) []int {
-	v := h.GetIntSlice(key)
-	if len(v) == 0 {
-		return defaultValue
-	}
-	return v
+	return GetAs(h, key, WithDefault(defaultValue))
 }
 
 func GetStringMapVal(key string, defaultValue map[string]interface{}) map[string]interface{} {
@@ -373,11 +386,7 @@ func GetStringMapVal(key string, defaultValue map[string]interface{}) map[string
 }
 
 func (h *Hierarchy) GetStringMapVal(key string, defaultValue map[string]interface{}) map[string]interface{} {
-	v := h.GetStringMap(key)
-	if len(v) == 0 {
-		return defaultValue
-	}
-	return v
+	return GetAs(h, key, WithDefault(defaultValue))
 }
 
 func GetStringMapStringVal(key string, defaultValue map[string]string) map[string]string {
@@ -385,11 +394,7 @@ func GetStringMapStringVal(key string, defaultValue map[string]string) map[strin
 }
 
 func (h *Hierarchy) GetStringMapStringVal(key string, defaultValue map[string]string) map[string]string {
-	v := h.GetStringMapString(key)
-	if len(v) == 0 {
-		return defaultValue
-	}
-	return v
+	return GetAs(h, key, WithDefault(defaultValue))
 }
 
 func GetStringMapStringSliceVal(key string, defaultValue map[string][]string) map[string][]string {
@@ -397,11 +402,7 @@ func GetStringMapStringSliceVal(key string, defaultValue map[string][]string) ma
 }
 
 func (h *Hierarchy) GetStringMapStringSliceVal(key string, defaultValue map[string][]string) map[string][]string {
-	v := h.GetStringMapStringSlice(key)
-	if len(v) == 0 {
-		return defaultValue
-	}
-	return v
+	return GetAs(h, key, WithDefault(defaultValue))
 }
 
 func GetSizeInBytesVal(key string, defaultValue uint) uint {
@@ -409,9 +410,5 @@ func GetSizeInBytesVal(key string, defaultValue uint) uint {
 }
 
 func (h *Hierarchy) GetSizeInBytesVal(key string, defaultValue uint) uint {
-	v := h.GetSizeInBytes(key)
-	if v == 0 {
-		return defaultValue
-	}
-	return v
+	return uint(GetAs(h, key, WithDefault(ByteSize(defaultValue))))
 }
@@ -0,0 +1,389 @@
+package hierarchy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudlibraries/libra/assets"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrIncludeCycle   = errors.New("include cycle")
+	ErrInvalidInclude = errors.New("invalid include")
+)
+
+const (
+	// includeKey lists the assets a file is based on, e.g. `$include: [common/logging.yaml]`.
+	includeKey = "$include"
+	// includeTag replaces a YAML node by the content of an asset, e.g. `hooks: !include hooks.yaml`.
+	includeTag = "!include"
+)
+
+// LoadOption configures LoadAssetMap.
+type LoadOption func(*loader)
+
+// WithAssets resolves included assets missing from the asset map through a.
+func WithAssets(a *assets.Assets) LoadOption {
+	return func(l *loader) {
+		l.assets = a
+	}
+}
+
+// loader reads assets, expanding their includes.
+type loader struct {
+	assetMap map[string][]byte
+	assets   *assets.Assets
+	keys     KeyProvider
+	// protoMessage is the type of protobuf assets, see WithProtoMessage.
+	protoMessage proto.Message
+	stack        []string
+}
+
+func newLoader(assetMap map[string][]byte, opts ...LoadOption) *loader {
+	l := &loader{assetMap: assetMap}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// annotations tell, for the lowercased key paths of a loaded asset, where each value
+// was set, how each key was cased, when known, and which values were decrypted.
+type annotations struct {
+	origins   map[string]Origin
+	cases     map[string]string
+	sensitive map[string]bool
+}
+
+func newAnnotations() *annotations {
+	return &annotations{
+		origins:   make(map[string]Origin),
+		cases:     make(map[string]string),
+		sensitive: make(map[string]bool),
+	}
+}
+
+// add adds the annotations of a value merged at path.
+func (a *annotations) add(path string, b *annotations) {
+	for key, origin := range b.origins {
+		a.origins[joinPath(path, key)] = origin
+	}
+
+	for key, name := range b.cases {
+		a.cases[joinPath(path, key)] = name
+	}
+
+	for key := range b.sensitive {
+		a.sensitive[joinPath(path, key)] = true
+	}
+}
+
+// addCases records the case of the keys of value, at path.
+func (a *annotations) addCases(path string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			childPath := joinPath(path, strings.ToLower(key))
+			if key != strings.ToLower(key) {
+				a.cases[childPath] = key
+			}
+
+			a.addCases(childPath, child)
+		}
+	case []interface{}:
+		for index, child := range v {
+			a.addCases(joinPath(path, fmt.Sprint(index)), child)
+		}
+	}
+}
+
+func (a *annotations) applyProfiles(profiles []string) *annotations {
+	return &annotations{
+		origins:   applyProfilePaths(a.origins, profiles),
+		cases:     applyProfilePaths(a.cases, profiles),
+		sensitive: applyProfilePaths(a.sensitive, profiles),
+	}
+}
+
+// loadSettings loads a top level asset, which must hold a map.
+func (l *loader) loadSettings(name string) (map[string]interface{}, *annotations, error) {
+	value, notes, err := l.load(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	settings, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: %w", name, ErrHierachyShouldBeMap)
+	}
+
+	return settings, notes, nil
+}
+
+func (l *loader) load(name string) (interface{}, *annotations, error) {
+	for index, loaded := range l.stack {
+		if loaded == name {
+			chain := append(append([]string{}, l.stack[index:]...), name)
+
+			return nil, nil, fmt.Errorf("%w: %s", ErrIncludeCycle, strings.Join(chain, " -> "))
+		}
+	}
+
+	l.stack = append(l.stack, name)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+
+	data, err := l.read(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	notes := newAnnotations()
+
+	value, err := l.parse(name, data, notes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if value, err = l.decrypt(name, value, notes); err != nil {
+		return nil, nil, err
+	}
+
+	settings, ok := value.(map[string]interface{})
+	if !ok {
+		return value, notes, nil
+	}
+
+	includes, ok := settings[includeKey]
+	if !ok {
+		return settings, notes, nil
+	}
+
+	delete(settings, includeKey)
+	delete(notes.origins, includeKey)
+
+	names, err := cast.ToStringSliceE(includes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w: %s: %v", name, ErrInvalidInclude, includeKey, err)
+	}
+
+	base := make(map[string]interface{})
+	baseNotes := newAnnotations()
+
+	for _, include := range names {
+		included, includedNotes, err := l.load(includePath(name, include))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		m, ok := included.(map[string]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: %w: %s: %v", name, ErrInvalidInclude, include, ErrHierachyShouldBeMap)
+		}
+
+		mergeTree(base, m, true)
+		baseNotes.add("", includedNotes)
+	}
+
+	mergeTree(base, settings, true)
+	baseNotes.add("", notes)
+
+	return base, baseNotes, nil
+}
+
+func (l *loader) read(name string) ([]byte, error) {
+	if data, ok := l.assetMap[name]; ok {
+		return data, nil
+	}
+
+	if l.assets == nil {
+		return nil, fmt.Errorf("%w: %s", assets.ErrAssetNotFound, name)
+	}
+
+	return l.assets.GetAsset(name)
+}
+
+func (l *loader) parse(name string, data []byte, notes *annotations) (interface{}, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+
+	switch ext {
+	case ".yaml", ".yml":
+		return l.parseYAML(name, data, notes)
+	case ".textproto", ".txtpb", ".pbtxt", ".pb", ".binpb":
+		value, err := l.parseProto(data, ext != ".pb" && ext != ".binpb")
+		if err != nil {
+			return nil, err
+		}
+
+		notes.addCases("", value)
+
+		return insensitivise(value), nil
+	case "":
+		return nil, fmt.Errorf("%w: missing extension", viper.UnsupportedConfigError(name))
+	}
+
+	v := viper.New()
+	v.SetConfigType(ext[1:])
+
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	// Viper lowercases keys, so their case is read from the decoded tree.
+	var tree interface{}
+
+	switch ext {
+	case ".json":
+		_ = json.Unmarshal(data, &tree)
+	case ".toml":
+		_ = toml.Unmarshal(data, &tree)
+	}
+
+	notes.addCases("", tree)
+
+	return v.AllSettings(), nil
+}
+
+func (l *loader) parseYAML(name string, data []byte, notes *annotations) (interface{}, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+
+	if err := l.expandIncludeTags(name, &node, "", notes); err != nil {
+		return nil, err
+	}
+
+	annotateYAML(name, &node, "", notes)
+
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	if m, ok := value.(map[string]interface{}); ok {
+		return normalizeSettings(m), nil
+	}
+
+	if value == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	return value, nil
+}
+
+func (l *loader) expandIncludeTags(name string, node *yaml.Node, path string, notes *annotations) error {
+	if node.Tag == includeTag {
+		if node.Kind != yaml.ScalarNode {
+			return fmt.Errorf("%w: line %d: %s expects an asset name", ErrInvalidInclude, node.Line, includeTag)
+		}
+
+		included, includedNotes, err := l.load(includePath(name, node.Value))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+
+		var replaced yaml.Node
+		if err := replaced.Encode(included); err != nil {
+			return err
+		}
+
+		*node = replaced
+
+		notes.add(path, includedNotes)
+
+		return nil
+	}
+
+	for index, child := range node.Content {
+		childPath := path
+
+		switch node.Kind {
+		case yaml.MappingNode:
+			if index%2 == 0 {
+				continue
+			}
+
+			childPath = joinPath(path, strings.ToLower(node.Content[index-1].Value))
+		case yaml.SequenceNode:
+			childPath = joinPath(path, fmt.Sprint(index))
+		}
+
+		if err := l.expandIncludeTags(name, child, childPath, notes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// annotateYAML records the line and case of every key of node. Nodes of included assets,
+// which have no line, keep the annotations recorded when they were included.
+func annotateYAML(name string, node *yaml.Node, path string, notes *annotations) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			annotateYAML(name, child, path, notes)
+		}
+	case yaml.MappingNode:
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			key, value := node.Content[index], node.Content[index+1]
+			if key.Line == 0 {
+				continue
+			}
+
+			childPath := joinPath(path, strings.ToLower(key.Value))
+			if key.Value != strings.ToLower(key.Value) {
+				notes.cases[childPath] = key.Value
+			}
+
+			if value.Kind == yaml.MappingNode && value.Line != 0 {
+				annotateYAML(name, value, childPath, notes)
+
+				continue
+			}
+
+			if value.Line != 0 {
+				notes.origins[childPath] = Origin{Kind: SourceAsset, Name: name, Line: key.Line}
+			}
+
+			if value.Kind == yaml.SequenceNode {
+				annotateYAML(name, value, childPath, notes)
+			}
+		}
+	case yaml.SequenceNode:
+		for index, child := range node.Content {
+			annotateYAML(name, child, joinPath(path, fmt.Sprint(index)), notes)
+		}
+	}
+}
+
+// includePath resolves an include relative to the asset including it.
+func includePath(from, include string) string {
+	include = filepath.ToSlash(include)
+	if path.IsAbs(include) {
+		return include
+	}
+
+	return path.Join(path.Dir(from), include)
+}
+
+// normalizeSettings lowercases keys the way viper does when reading a config.
+func normalizeSettings(m map[string]interface{}) map[string]interface{} {
+	v := viper.New()
+	if err := v.MergeConfigMap(m); err != nil {
+		return m
+	}
+
+	return v.AllSettings()
+}
@@ -0,0 +1,121 @@
+package hierarchy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudlibraries/libra/assets"
+)
+
+// includeAssets serves the assets of files, which the asset map of a load lacks.
+func includeAssets(t *testing.T, files map[string]string) *assets.Assets {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return assets.New(assets.NewFileSystemProvider(dir))
+}
+
+func TestLoadIncludes(t *testing.T) {
+	h := New()
+	if err := h.LoadAssetMap(map[string][]byte{
+		"conf/app.yaml": []byte("$include: [common/logging.yaml]\nlogger: {level: warn}\nhooks: !include common/hooks.yaml\n"),
+	}, WithAssets(includeAssets(t, map[string]string{
+		"conf/common/logging.yaml": "logger:\n  level: info\n  format: json\n",
+		"conf/common/hooks.yaml":   "- type: slack\n- type: mail\n",
+	}))); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]interface{}{
+		"logger.level":  "warn",
+		"logger.format": "json",
+		"hooks.1.type":  "mail",
+	}
+	for key, want := range tests {
+		if got := h.Get(key); got != want {
+			t.Errorf("Get(%s) = %#v, want %#v", key, got, want)
+		}
+	}
+
+	if h.IsSet(includeKey) {
+		t.Errorf("%s is still set", includeKey)
+	}
+
+	explanation := h.Explain("logger.format")
+	if winner := explanation.Origins[explanation.Winner]; winner.Name != "conf/common/logging.yaml" || winner.Line != 3 {
+		t.Errorf("Explain(logger.format) = %+v, want conf/common/logging.yaml:3", winner)
+	}
+}
+
+func TestLoadIncludeErrors(t *testing.T) {
+	tests := map[string]struct {
+		assetMap map[string][]byte
+		files    map[string]string
+		err      error
+	}{
+		"cycle": {
+			assetMap: map[string][]byte{
+				"a.yaml":     []byte("$include: [sub/b.yaml]\n"),
+				"sub/b.yaml": []byte("hooks: !include ../a.yaml\n"),
+			},
+			err: ErrIncludeCycle,
+		},
+		"missing": {
+			assetMap: map[string][]byte{"app.yaml": []byte("$include: [missing.yaml]\n")},
+			err:      assets.ErrAssetNotFound,
+		},
+		"not a map": {
+			assetMap: map[string][]byte{"app.yaml": []byte("$include: [hooks.yaml]\n")},
+			files:    map[string]string{"hooks.yaml": "- type: slack\n"},
+			err:      ErrInvalidInclude,
+		},
+		"tag on a map": {
+			assetMap: map[string][]byte{"app.yaml": []byte("hooks: !include {name: hooks.yaml}\n")},
+			err:      ErrInvalidInclude,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := New()
+			if err := h.LoadAssetMap(test.assetMap, WithAssets(includeAssets(t, test.files))); !errors.Is(err, test.err) {
+				t.Fatalf("LoadAssetMap() = %v, want %v", err, test.err)
+			}
+
+			if settings := h.AllSettings(); len(settings) != 0 {
+				t.Errorf("AllSettings() = %v, want nothing merged", settings)
+			}
+		})
+	}
+}
+
+func TestIncludePath(t *testing.T) {
+	tests := []struct {
+		from, include, want string
+	}{
+		{"app.yaml", "common.yaml", "common.yaml"},
+		{"conf/app.yaml", "common.yaml", "conf/common.yaml"},
+		{"conf/app.yaml", "../common.yaml", "common.yaml"},
+		{"conf/app.yaml", "/shared/common.yaml", "/shared/common.yaml"},
+	}
+
+	for _, test := range tests {
+		if got := includePath(test.from, test.include); got != test.want {
+			t.Errorf("includePath(%q, %q) = %q, want %q", test.from, test.include, got, test.want)
+		}
+	}
+}
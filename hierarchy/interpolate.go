@@ -0,0 +1,307 @@
+package hierarchy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cast"
+)
+
+var (
+	ErrUnresolvedReference = errors.New("unresolved reference")
+	ErrReferenceRequired   = errors.New("required reference")
+)
+
+// ResolverFunc resolves the key of a namespaced reference such as ${env:HOME}.
+// It returns false when the key does not exist so that ${ns:key:-default} can apply.
+type ResolverFunc func(key string) (string, bool, error)
+
+var (
+	resolverMutex sync.RWMutex
+	resolverMap   = map[string]ResolverFunc{
+		"env":    resolveEnv,
+		"file":   resolveFile,
+		"secret": resolveSecret,
+	}
+)
+
+// RegisterResolver makes references of the form ${name:key} resolve through fn.
+func RegisterResolver(name string, fn ResolverFunc) {
+	resolverMutex.Lock()
+	defer resolverMutex.Unlock()
+
+	resolverMap[name] = fn
+}
+
+func lookupResolver(name string) (ResolverFunc, bool) {
+	resolverMutex.RLock()
+	defer resolverMutex.RUnlock()
+
+	fn, ok := resolverMap[name]
+
+	return fn, ok
+}
+
+func resolveEnv(key string) (string, bool, error) {
+	value, ok := os.LookupEnv(key)
+
+	return value, ok, nil
+}
+
+func resolveFile(key string) (string, bool, error) {
+	data, err := os.ReadFile(key)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// InterpolationError lists every reference that could not be resolved.
+type InterpolationError struct {
+	Unresolved []string
+	Errors     []error
+}
+
+func (e *InterpolationError) Error() string {
+	messages := make([]string, 0, len(e.Errors)+1)
+	if len(e.Unresolved) > 0 {
+		messages = append(messages, fmt.Sprintf("%s: %s", ErrUnresolvedReference, strings.Join(e.Unresolved, ", ")))
+	}
+
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e *InterpolationError) Is(target error) bool {
+	if target == ErrUnresolvedReference && len(e.Unresolved) > 0 {
+		return true
+	}
+
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *InterpolationError) empty() bool {
+	return len(e.Unresolved) == 0 && len(e.Errors) == 0
+}
+
+// segment is either literal text or a ${...} reference.
+type segment struct {
+	literal string
+	ref     *reference
+}
+
+// reference is a parsed ${namespace:key:-default} or ${key:?message} expression.
+type reference struct {
+	raw       string
+	namespace string
+	key       string
+	op        string
+	arg       []segment
+}
+
+var namespaceExp = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9_]*):`)
+
+// parseTemplate splits s into literals and references.
+// $${ escapes a literal ${ and an unterminated ${ is kept as text.
+func parseTemplate(s string) []segment {
+	var (
+		segments []segment
+		literal  strings.Builder
+	)
+
+	for index := 0; index < len(s); {
+		switch {
+		case strings.HasPrefix(s[index:], "$${"):
+			literal.WriteString("${")
+			index += 3
+		case strings.HasPrefix(s[index:], "${"):
+			end := matchBrace(s, index+2)
+			if end < 0 {
+				literal.WriteString(s[index:])
+				index = len(s)
+
+				continue
+			}
+
+			if literal.Len() > 0 {
+				segments = append(segments, segment{literal: literal.String()})
+				literal.Reset()
+			}
+
+			segments = append(segments, segment{ref: parseReference(s[index+2 : end])})
+			index = end + 1
+		default:
+			literal.WriteByte(s[index])
+			index++
+		}
+	}
+
+	if literal.Len() > 0 {
+		segments = append(segments, segment{literal: literal.String()})
+	}
+
+	return segments
+}
+
+// matchBrace returns the index of the } closing a ${ whose body starts at start.
+func matchBrace(s string, start int) int {
+	depth := 1
+
+	for index := start; index < len(s); index++ {
+		switch {
+		case strings.HasPrefix(s[index:], "${"):
+			depth++
+			index++
+		case s[index] == '}':
+			depth--
+			if depth == 0 {
+				return index
+			}
+		}
+	}
+
+	return -1
+}
+
+func parseReference(raw string) *reference {
+	ref := &reference{raw: raw}
+	body := raw
+
+	if match := namespaceExp.FindStringSubmatch(body); match != nil {
+		rest := body[len(match[0]):]
+		if !strings.HasPrefix(rest, "-") && !strings.HasPrefix(rest, "?") {
+			ref.namespace = match[1]
+			body = rest
+		}
+	}
+
+	ref.key = body
+
+	for _, op := range []string{":-", ":?"} {
+		if index := strings.Index(body, op); index >= 0 {
+			ref.key = body[:index]
+			ref.op = op
+			ref.arg = parseTemplate(body[index+len(op):])
+
+			break
+		}
+	}
+
+	return ref
+}
+
+// lookupFunc resolves a reference in the default namespace, i.e. a hierarchy key.
+type lookupFunc func(key string) (string, bool, error)
+
+// namespaceFunc returns the resolver of a namespace, see lookupResolver.
+type namespaceFunc func(name string) (ResolverFunc, bool)
+
+// expand renders segments, recording every failure in errs instead of stopping at the first.
+// Namespaced references resolve through namespaces.
+func expand(segments []segment, lookup lookupFunc, namespaces namespaceFunc, errs *InterpolationError) string {
+	var buf strings.Builder
+
+	for _, seg := range segments {
+		if seg.ref == nil {
+			buf.WriteString(seg.literal)
+
+			continue
+		}
+
+		buf.WriteString(seg.ref.expand(lookup, namespaces, errs))
+	}
+
+	return buf.String()
+}
+
+func (r *reference) expand(lookup lookupFunc, namespaces namespaceFunc, errs *InterpolationError) string {
+	resolve := lookup
+
+	if r.namespace != "" {
+		fn, ok := namespaces(r.namespace)
+		if !ok {
+			errs.Errors = append(errs.Errors, fmt.Errorf("%w: ${%s}: resolver %q not found", ErrUnresolvedReference, r.raw, r.namespace))
+
+			return ""
+		}
+
+		resolve = lookupFunc(fn)
+	}
+
+	value, ok, err := resolve(r.key)
+	if err != nil {
+		errs.Errors = append(errs.Errors, fmt.Errorf("${%s}: %w", r.raw, err))
+
+		return ""
+	}
+
+	if ok {
+		return value
+	}
+
+	switch r.op {
+	case ":-":
+		return expand(r.arg, lookup, namespaces, errs)
+	case ":?":
+		message := expand(r.arg, lookup, namespaces, errs)
+		if message == "" {
+			message = "is not set"
+		}
+
+		errs.Errors = append(errs.Errors, fmt.Errorf("%w: %s: %s", ErrReferenceRequired, r.key, message))
+	default:
+		errs.Unresolved = append(errs.Unresolved, r.raw)
+	}
+
+	return ""
+}
+
+// lookupString resolves a reference against the keys of the hierarchy.
+func (h *Hierarchy) lookupString(key string) (string, bool, error) {
+	if !h.IsSet(key) {
+		return "", false, nil
+	}
+
+	value, err := cast.ToStringE(h.Get(key))
+	if err != nil {
+		return "", true, err
+	}
+
+	return value, true, nil
+}
+
+// ReplaceAllVars expands references in data:
+//
+//	${a.b.c}            value of a hierarchy key
+//	${key:-default}     default when key is not set
+//	${key:?message}     error with message when key is not set
+//	${env:HOME}         namespaced resolver, see RegisterResolver
+//	$${literal}         escaped, rendered as ${literal}
+//
+// The error lists every reference that could not be resolved.
+func (h *Hierarchy) ReplaceAllVars(data []byte) ([]byte, error) {
+	errs := &InterpolationError{}
+
+	out := expand(parseTemplate(string(data)), h.lookupString, lookupResolver, errs)
+	if !errs.empty() {
+		return nil, errs
+	}
+
+	return []byte(out), nil
+}
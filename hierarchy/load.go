@@ -1,60 +1,289 @@
 package hierarchy
 
 import (
-	"bytes"
-	"path/filepath"
-	"sort"
+	"errors"
+	"io"
+	"log"
+	"strings"
 
+	"github.com/cloudlibraries/libra/assets"
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/pflag"
-	"github.com/spf13/viper"
 )
 
+var ErrRemoteConfig = errors.New("remote config is not supported")
+
 func LoadEnv(prefix string) error {
 	return _default.LoadEnv(prefix)
 }
 
+// LoadEnv applies the env vars named after keys under prefix, e.g. `APP_LOGGER_LEVEL`
+// for `logger.level`. `__` stands for an underscore in a key, and indexes address array
+// items, e.g. `APP_HOOKS_0_CHAT__ID`. Values are converted to the type of the value they
+// override, and may set whole subtrees as JSON. Keys missing from the hierarchy are added,
+// unless prefix is empty. Env vars are read once, overriding assets loaded before or after,
+// and are listed by EnvVars.
 func (h *Hierarchy) LoadEnv(prefix string) error {
-	h.AutomaticEnv()
-	h.SetEnvPrefix(prefix)
+	if h.root != nil {
+		return h.root.LoadEnv(prefix)
+	}
+
+	return h.update(func(l *layers) error {
+		if err := h.applyEnv(l, prefix); err != nil {
+			return err
+		}
 
-	return nil
+		h.envPrefix = prefix
+
+		return nil
+	})
 }
 
 func LoadFlags(flags *pflag.FlagSet) error {
 	return _default.LoadFlags(flags)
 }
 
+// LoadFlags binds the flags of flags to the keys they are named after, e.g. `--logger.level`
+// to `logger.level`, and applies the --profiles and set flags, see AddProfilesFlag and
+// AddSetFlags. Flags generated without a default only override keys when given. Flags
+// are read when loaded, so load them once parsed.
 func (h *Hierarchy) LoadFlags(flags *pflag.FlagSet) error {
-	return BindPFlags(flags)
+	if h.root != nil {
+		return h.root.LoadFlags(flags)
+	}
+
+	if flag := flags.Lookup(ProfilesFlag); flag != nil && flag.Changed {
+		profiles, err := flags.GetStringSlice(ProfilesFlag)
+		if err != nil {
+			return err
+		}
+
+		h.SetProfiles(profiles...)
+	}
+
+	values, err := parseSetFlags(flags)
+	if err != nil {
+		return err
+	}
+
+	return h.update(func(l *layers) error {
+		flags.VisitAll(func(flag *pflag.Flag) {
+			switch {
+			case err != nil, isReservedFlag(flag.Name):
+			case !flag.Changed && flag.Annotations[noDefaultAnnotation] != nil:
+			default:
+				err = h.bindFlag(l, flag.Name, flag)
+			}
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return h.applySets(l, values)
+	})
+}
+
+// ReadInConfig reads the config file viper finds, see SetConfigFile, SetConfigName and
+// AddConfigPath, and merges it into the config like LoadAssetMap. Reading a file again
+// replaces the values it set before, removing the keys it no longer has.
+func (h *Hierarchy) ReadInConfig() error {
+	return h.readConfig(h.Viper.ReadInConfig, h.Viper.ConfigFileUsed)
+}
+
+// MergeInConfig is ReadInConfig, as every source merges into the hierarchy.
+func (h *Hierarchy) MergeInConfig() error {
+	return h.ReadInConfig()
 }
 
-func LoadConfigMap(m map[string][]byte) error {
-	return _default.LoadAssetMap(m)
+// ReadConfig reads a config in the format of SetConfigType from in, and merges it into
+// the config like MergeConfigMap.
+func (h *Hierarchy) ReadConfig(in io.Reader) error {
+	return h.readConfig(func() error {
+		return h.Viper.ReadConfig(in)
+	}, nil)
 }
 
-func (h *Hierarchy) LoadAssetMap(assetMap map[string][]byte) error {
-	keys := make([]string, 0, len(assetMap))
-	for name := range assetMap {
-		keys = append(keys, name)
+// MergeConfig is ReadConfig, as every source merges into the hierarchy.
+func (h *Hierarchy) MergeConfig(in io.Reader) error {
+	return h.ReadConfig(in)
+}
+
+// readConfig has the embedded viper parse a config with read, then merges its settings,
+// which are the config alone as the viper holds nothing else. file names the config file
+// read, whose previous settings the config replaces; it is nil for readers.
+func (h *Hierarchy) readConfig(read func() error, file func() string) error {
+	origin := callOrigin(SourceMerge)
+
+	if err := read(); err != nil {
+		return err
 	}
 
-	sort.Strings(keys)
+	settings := h.Viper.AllSettings()
 
-	for _, name := range keys {
-		ext := filepath.Ext(name)
-		data := h.ReplaceAllVars(assetMap[name])
+	if file == nil {
+		return h.load(func(l *layers) error {
+			return h.mergeConfig(l, "", settings, origin)
+		})
+	}
 
-		v := viper.New()
-		v.SetConfigType(ext[1:])
+	name := file()
+	key := h.absolute(name)
 
-		if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+	return h.load(func(l *layers) error {
+		if err := h.mergeConfig(l, key, withRemoved(l.reads[key], settings), func(string) Origin {
+			return Origin{Kind: SourceAsset, Name: name}
+		}); err != nil {
 			return err
 		}
 
-		if err := h.MergeConfigMap(v.AllSettings()); err != nil {
-			return err
+		l.reads[key] = settings
+
+		return nil
+	})
+}
+
+// withRemoved returns settings with a tombstone for every key of previous it lacks.
+func withRemoved(previous, settings map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(settings))
+	for key, value := range settings {
+		m[key] = value
+	}
+
+	for key, value := range previous {
+		child, ok := settings[key]
+		if !ok {
+			m[key] = Tombstone
+
+			continue
+		}
+
+		previousMap, isMap := value.(map[string]interface{})
+		if childMap, ok := child.(map[string]interface{}); ok && isMap {
+			m[key] = withRemoved(previousMap, childMap)
 		}
 	}
 
-	return nil
+	return m
+}
+
+// WatchConfig reads the config file again with ReadInConfig when it changes, then calls
+// the function given to OnConfigChange. Errors are logged.
+func (h *Hierarchy) WatchConfig() {
+	h.Viper.OnConfigChange(func(event fsnotify.Event) {
+		if err := h.ReadInConfig(); err != nil {
+			log.Printf("hierarchy: %s: %v", event.Name, err)
+
+			return
+		}
+
+		h.mu.Lock()
+		run := h.configChange
+		h.mu.Unlock()
+
+		if run != nil {
+			run(event)
+		}
+	})
+	h.Viper.WatchConfig()
+}
+
+// OnConfigChange sets the function called once WatchConfig has read the changed config.
+func (h *Hierarchy) OnConfigChange(run func(in fsnotify.Event)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.configChange = run
+}
+
+// ReadRemoteConfig fails with ErrRemoteConfig: the key/value stores of the embedded viper
+// are not layers of the hierarchy. Fetch the config and load it with LoadAssetMap instead.
+func (h *Hierarchy) ReadRemoteConfig() error {
+	return ErrRemoteConfig
+}
+
+// WatchRemoteConfig fails with ErrRemoteConfig, see ReadRemoteConfig.
+func (h *Hierarchy) WatchRemoteConfig() error {
+	return ErrRemoteConfig
+}
+
+// WatchRemoteConfigOnChannel fails with ErrRemoteConfig, see ReadRemoteConfig.
+func (h *Hierarchy) WatchRemoteConfigOnChannel() error {
+	return ErrRemoteConfig
+}
+
+func LoadConfigMap(m map[string][]byte, opts ...LoadOption) error {
+	return _default.LoadAssetMap(m, opts...)
+}
+
+// LoadAssetMap merges base assets in name order, then the profile-suffixed assets
+// such as app.prod.yaml of each active profile, see Profiles. A suffix is a profile when
+// the assets hold the name without it, app.yaml, or when it names an active profile or one
+// declared with DeclareProfiles: foo.v2.json alone is a base asset. The assets of inactive
+// profiles are skipped and logged.
+// The `profiles.<name>` sections of an asset are merged over it for each active profile.
+//
+// An asset may include other assets with a top level `$include: [name, ...]` key,
+// or in YAML a `!include name` tag, resolved relative to the including asset.
+//
+// Values encrypted like `token: ENC[AES256_GCM,data:...,iv:...,tag:...,type:str]`, see
+// EncryptAsset, are decrypted with the key of WithKeyProvider, or the KeyEnv env var, and
+// their keys are sensitive, see MarkSensitive.
+//
+// The load is atomic: on error, including a failed validation against the schemas
+// registered with RegisterSchema, a reference cycle or an unknown resolver namespace,
+// nothing is merged. Secret backends are not called by the load; see Resolve.
+// Subscribers are notified once every asset is merged.
+func (h *Hierarchy) LoadAssetMap(assetMap map[string][]byte, opts ...LoadOption) error {
+	profiles := h.Profiles()
+	loader := newLoader(assetMap, opts...)
+
+	names, skipped := orderAssets(assetMap, profiles, h.isProfile(profiles))
+
+	for _, name := range skipped {
+		log.Printf("hierarchy: %s: skipped, its profile is not active", name)
+	}
+
+	return h.load(func(l *layers) error {
+		for _, name := range names {
+			settings, notes, err := loader.loadSettings(name)
+			if err != nil {
+				return err
+			}
+
+			settings = applyProfileSections(settings, profiles)
+			notes = notes.applyProfiles(profiles)
+
+			// References stay in the tree and are resolved on read, so they see later sources too.
+			settings, _ = parseReferences(settings).(map[string]interface{})
+			if err := h.mergeConfig(l, h.absolute(name), settings, assetOrigin(name, notes.origins)); err != nil {
+				return err
+			}
+
+			prefix := strings.Join(splitKey(h.prefix), ".")
+			for path, key := range notes.cases {
+				l.recordCase(joinPath(prefix, path), key)
+			}
+
+			for path := range notes.sensitive {
+				l.sensitive[joinPath(prefix, path)] = true
+			}
+		}
+
+		return nil
+	})
+}
+
+func LoadBundle(a *assets.Assets, name string) error {
+	return _default.LoadBundle(a, name)
+}
+
+// LoadBundle loads the bundle name from a, resolving includes through a as well.
+func (h *Hierarchy) LoadBundle(a *assets.Assets, name string) error {
+	assetMap, err := a.GetBundle(name)
+	if err != nil {
+		return err
+	}
+
+	return h.LoadAssetMap(assetMap, WithAssets(a))
 }
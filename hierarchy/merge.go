@@ -0,0 +1,374 @@
+package hierarchy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+)
+
+var ErrInvalidMergeStrategy = errors.New("invalid merge strategy")
+
+const (
+	// mergeKey declares the strategies of the sibling keys in a merged map,
+	// e.g. `$merge: {hooks: append}` or `$merge: {hooks: "merge:type"}`.
+	mergeKey = "$merge"
+	// Tombstone removes an inherited key when merged, e.g. `hooks: $delete`.
+	// In an array merged by key, an item with `$delete: true` removes the matching item.
+	Tombstone = "$delete"
+)
+
+// tombstone is stored in place of deleted keys, which reads then treat as unset.
+type tombstone struct{}
+
+func isTombstone(value interface{}) bool {
+	_, ok := value.(tombstone)
+
+	return ok
+}
+
+// MergeStrategy tells how an array is merged into the array it overrides.
+type MergeStrategy struct {
+	name string
+	key  string
+}
+
+var (
+	// MergeReplace replaces the inherited array, which is the default.
+	MergeReplace = MergeStrategy{name: "replace"}
+	// MergeAppend appends items after the inherited ones.
+	MergeAppend = MergeStrategy{name: "append"}
+	// MergePrepend inserts items before the inherited ones.
+	MergePrepend = MergeStrategy{name: "prepend"}
+)
+
+// MergeByKey merges items with the inherited item holding the same value at key,
+// e.g. MergeByKey("type") for logger hooks. Unmatched items are appended.
+func MergeByKey(key string) MergeStrategy {
+	return MergeStrategy{name: "merge", key: strings.ToLower(key)}
+}
+
+// ParseMergeStrategy parses "replace", "append", "prepend" or "merge:<key>".
+func ParseMergeStrategy(s string) (MergeStrategy, error) {
+	switch name := strings.ToLower(strings.TrimSpace(s)); {
+	case name == MergeReplace.name:
+		return MergeReplace, nil
+	case name == MergeAppend.name:
+		return MergeAppend, nil
+	case name == MergePrepend.name:
+		return MergePrepend, nil
+	case strings.HasPrefix(name, "merge:") && len(name) > len("merge:"):
+		return MergeByKey(name[len("merge:"):]), nil
+	default:
+		return MergeStrategy{}, fmt.Errorf("%w: %q", ErrInvalidMergeStrategy, s)
+	}
+}
+
+func (s MergeStrategy) String() string {
+	if s.key != "" {
+		return s.name + ":" + s.key
+	}
+
+	return s.name
+}
+
+func SetMergeStrategy(key string, strategy MergeStrategy) {
+	_default.SetMergeStrategy(key, strategy)
+}
+
+// SetMergeStrategy sets how arrays at key are merged by MergeConfigMap and LoadAssetMap.
+func (h *Hierarchy) SetMergeStrategy(key string, strategy MergeStrategy) {
+	if h.root != nil {
+		h.root.SetMergeStrategy(h.absolute(key), strategy)
+
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.mergeStrategies[strings.ToLower(key)] = strategy
+}
+
+func Delete(key string) {
+	_default.Delete(key)
+}
+
+// Delete removes key, hiding any value it inherits from files or defaults.
+// Deleting an array item, e.g. `hooks[1]`, removes it from the array. Errors, such as an
+// index out of range, are logged; see DeleteE.
+func (h *Hierarchy) Delete(key string) {
+	if err := h.DeleteE(key); err != nil {
+		log.Printf("hierarchy: %v", err)
+	}
+}
+
+func DeleteE(key string) error {
+	return _default.DeleteE(key)
+}
+
+// DeleteE is like Delete, but returns its error. Deleting an item of a missing array, or
+// past its end, is ErrIndexOutOfRange.
+func (h *Hierarchy) DeleteE(key string) error {
+	if h.root != nil {
+		return h.root.DeleteE(h.absolute(key))
+	}
+
+	origin := callOrigin(SourceSet)
+
+	return h.update(func(l *layers) error {
+		path := splitKey(l.realKey(key))
+		if err := setKey(l.override, h.treeOf(l), path, tombstone{}); err != nil {
+			return err
+		}
+
+		l.record(strings.Join(path, "."), tombstone{}, origin)
+
+		return nil
+	})
+}
+
+// MergeConfigMap merges cfg into the config, applying merge strategies and tombstones.
+func (h *Hierarchy) MergeConfigMap(cfg map[string]interface{}) error {
+	origin := callOrigin(SourceMerge)
+
+	return h.update(func(l *layers) error {
+		return h.mergeConfig(l, "", cfg, origin)
+	})
+}
+
+// arrayMerge is an array merged by a source, see layers.merges.
+type arrayMerge struct {
+	// config is the value of the config the array was merged with, if hasConfig.
+	config    interface{}
+	hasConfig bool
+	result    []interface{}
+}
+
+// mergeConfig merges cfg from source into the config of l, recording origin for every
+// leaf it sets. source names an asset or file, which may be merged again, or is empty.
+func (h *Hierarchy) mergeConfig(l *layers, source string, cfg map[string]interface{}, origin func(path string) Origin) error {
+	if h.root != nil {
+		nested := make(map[string]interface{})
+		setPath(nested, splitKey(h.prefix), cfg)
+
+		return h.root.mergeConfig(l, source, nested, func(path string) Origin {
+			return origin(strings.TrimPrefix(path, h.prefix+"."))
+		})
+	}
+
+	arrays := make(map[string]arrayMerge)
+
+	merged, err := h.mergeMap(l, source, arrays, "", cfg)
+	if err != nil {
+		return err
+	}
+
+	if source != "" {
+		l.merges[source] = arrays
+	}
+
+	mergeTree(l.config, merged, true)
+	l.recordCases("", cfg)
+
+	for key, value := range merged {
+		l.record(key, value, origin)
+	}
+
+	return nil
+}
+
+// mergeMap merges the arrays of m from source with the ones they override, recording
+// them in arrays.
+func (h *Hierarchy) mergeMap(l *layers, source string, arrays map[string]arrayMerge, prefix string, m map[string]interface{}) (map[string]interface{}, error) {
+	directives := make(map[string]MergeStrategy)
+
+	for key, value := range m {
+		if strings.ToLower(key) != mergeKey {
+			continue
+		}
+
+		declared, ok := toStringMap(value)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s: %T", ErrInvalidMergeStrategy, joinPath(prefix, key), value)
+		}
+
+		for child, s := range declared {
+			strategy, err := ParseMergeStrategy(fmt.Sprint(s))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", joinPath(prefix, mergeKey), err)
+			}
+
+			directives[strings.ToLower(child)] = strategy
+		}
+	}
+
+	merged := make(map[string]interface{}, len(m))
+
+	for key, value := range m {
+		lcaseKey := strings.ToLower(key)
+		if lcaseKey == mergeKey {
+			continue
+		}
+
+		path := joinPath(prefix, lcaseKey)
+
+		switch v := insensitivise(value).(type) {
+		case string:
+			if v == Tombstone {
+				merged[lcaseKey] = tombstone{}
+
+				continue
+			}
+
+			merged[lcaseKey] = v
+		case map[string]interface{}:
+			child, err := h.mergeMap(l, source, arrays, path, v)
+			if err != nil {
+				return nil, err
+			}
+
+			merged[lcaseKey] = child
+		case []interface{}:
+			strategy, ok := directives[lcaseKey]
+			if !ok {
+				strategy = h.mergeStrategies[path]
+			}
+
+			config, hasConfig := l.inheritedConfig(source, path)
+			result := mergeArray(strategy, l.inherited(path, config, hasConfig), v)
+			arrays[path] = arrayMerge{config: config, hasConfig: hasConfig, result: result}
+			merged[lcaseKey] = result
+		default:
+			merged[lcaseKey] = v
+		}
+	}
+
+	return merged, nil
+}
+
+// inheritedConfig returns the value of the config at path that config merged from source
+// would override. When source merged an array there before, the arrays merged since are
+// unwound, following what each was merged with, down to what source merged its array
+// with, so that reloading a source does not merge its arrays with themselves.
+func (l *layers) inheritedConfig(source, path string) (interface{}, bool) {
+	current, hasCurrent := lookupPath(l.config, splitKey(path))
+	value, ok := current, hasCurrent
+	unwound := make(map[string]bool)
+
+	for ok {
+		next := ""
+
+		for name, arrays := range l.merges {
+			if last, merged := arrays[path]; merged && !unwound[name] && reflect.DeepEqual(value, last.result) {
+				next = name
+				value, ok = last.config, last.hasConfig
+
+				break
+			}
+		}
+
+		if next == "" {
+			break
+		} else if next == source {
+			return value, ok
+		}
+
+		unwound[next] = true
+	}
+
+	return current, hasCurrent
+}
+
+// inherited returns the value at path that merged config would override: config, when
+// the config has one, or the default.
+func (l *layers) inherited(path string, config interface{}, hasConfig bool) interface{} {
+	value, ok := config, hasConfig
+	if !ok {
+		value, ok = lookupPath(l.defaults, splitKey(path))
+	}
+
+	if !ok || isTombstone(value) {
+		return nil
+	}
+
+	return value
+}
+
+func mergeArray(strategy MergeStrategy, inherited interface{}, items []interface{}) []interface{} {
+	base, ok := toSlice(inherited)
+	if !ok || strategy.name == "" || strategy == MergeReplace {
+		return items
+	}
+
+	switch strategy.name {
+	case MergeAppend.name:
+		return append(append([]interface{}{}, base...), items...)
+	case MergePrepend.name:
+		return append(append([]interface{}{}, items...), base...)
+	default:
+		return mergeArrayByKey(strategy.key, base, items)
+	}
+}
+
+func mergeArrayByKey(key string, base, items []interface{}) []interface{} {
+	merged := append([]interface{}{}, base...)
+	removed := make(map[int]bool)
+
+	for _, item := range items {
+		m, ok := toStringMap(item)
+		id, hasID := lookupFold(m, key)
+
+		index := -1
+		if ok && hasID {
+			index = indexByKey(merged, key, id)
+		}
+
+		deleted, _ := lookupFold(m, Tombstone)
+		if deleted == true {
+			if index >= 0 {
+				removed[index] = true
+			}
+
+			continue
+		}
+
+		if index < 0 {
+			merged = append(merged, item)
+
+			continue
+		}
+
+		inherited, _ := toStringMap(merged[index])
+		combined := make(map[string]interface{}, len(inherited)+len(m))
+		mergeTree(combined, inherited, false)
+		mergeTree(combined, m, false)
+		merged[index] = combined
+	}
+
+	result := make([]interface{}, 0, len(merged))
+
+	for index, item := range merged {
+		if !removed[index] {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+func indexByKey(items []interface{}, key string, id interface{}) int {
+	for index, item := range items {
+		m, ok := toStringMap(item)
+		if !ok {
+			continue
+		}
+
+		if value, ok := lookupFold(m, key); ok && reflect.DeepEqual(value, id) {
+			return index
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,206 @@
+package hierarchy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const hooksYAML = "logger:\n  level: info\n  hooks:\n    - {type: file, level: info}\n    - {type: stdout, level: debug}\n"
+
+func TestMergeStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		override map[string]interface{}
+		want     []interface{}
+	}{
+		{
+			name:     "replace",
+			override: map[string]interface{}{"hooks": []interface{}{"stderr"}},
+			want:     []interface{}{"stderr"},
+		},
+		{
+			name: "append",
+			override: map[string]interface{}{
+				"$merge": map[string]interface{}{"hooks": "append"},
+				"hooks":  []interface{}{"stderr"},
+			},
+			want: []interface{}{"file", "stdout", "stderr"},
+		},
+		{
+			name: "prepend",
+			override: map[string]interface{}{
+				"$merge": map[string]interface{}{"hooks": "prepend"},
+				"hooks":  []interface{}{"stderr"},
+			},
+			want: []interface{}{"stderr", "file", "stdout"},
+		},
+	}
+
+	for _, test := range tests {
+		h := New()
+		if err := h.MergeConfigMap(map[string]interface{}{"hooks": []interface{}{"file", "stdout"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := h.MergeConfigMap(test.override); err != nil {
+			t.Errorf("%s: MergeConfigMap error = %v", test.name, err)
+
+			continue
+		}
+
+		if got := h.Get("hooks"); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: hooks = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMergeByKey(t *testing.T) {
+	h := New()
+	h.SetMergeStrategy("logger.hooks", MergeByKey("type"))
+	h.SetProfiles("prod")
+
+	if err := h.LoadAssetMap(map[string][]byte{
+		"app.yaml":      []byte(hooksYAML),
+		"app.prod.yaml": []byte("logger:\n  hooks:\n    - {type: file, level: warn}\n    - {type: stdout, $delete: true}\n    - {type: syslog}\n"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []interface{}{
+		map[string]interface{}{"type": "file", "level": "warn"},
+		map[string]interface{}{"type": "syslog"},
+	}
+	if got := h.Get("logger.hooks"); !reflect.DeepEqual(got, want) {
+		t.Errorf("logger.hooks = %v, want %v", got, want)
+	}
+}
+
+func TestTombstone(t *testing.T) {
+	h := New()
+	h.SetDefault("logger.format", "json")
+
+	if err := h.LoadAssetMap(map[string][]byte{"app.yaml": []byte(hooksYAML)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.MergeConfigMap(map[string]interface{}{
+		"logger": map[string]interface{}{"hooks": Tombstone, "format": Tombstone},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"logger.hooks", "logger.format"} {
+		if h.IsSet(key) || h.Get(key) != nil {
+			t.Errorf("%s = %v after the tombstone, want it unset", key, h.Get(key))
+		}
+	}
+
+	if got := h.GetString("logger.level"); got != "info" {
+		t.Errorf("logger.level = %q, want info", got)
+	}
+
+	if keys := h.AllKeys(); !reflect.DeepEqual(keys, []string{"logger.level"}) {
+		t.Errorf("AllKeys = %v, want [logger.level]", keys)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	h := New()
+	if err := h.LoadAssetMap(map[string][]byte{"app.yaml": []byte(hooksYAML)}); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Delete("logger.hooks[0]")
+
+	if got := h.GetString("logger.hooks.0.type"); got != "stdout" {
+		t.Errorf("logger.hooks.0.type = %q, want stdout", got)
+	}
+
+	if err := h.DeleteE("logger.hooks.5"); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("DeleteE(logger.hooks.5) error = %v, want %v", err, ErrIndexOutOfRange)
+	}
+
+	h.Delete("logger.level")
+
+	if h.IsSet("logger.level") {
+		t.Error("logger.level is set after Delete")
+	}
+}
+
+func TestParseMergeStrategy(t *testing.T) {
+	tests := map[string]MergeStrategy{
+		"append":     MergeAppend,
+		" Prepend ":  MergePrepend,
+		"replace":    MergeReplace,
+		"merge:Type": MergeByKey("type"),
+	}
+	for s, want := range tests {
+		if got, err := ParseMergeStrategy(s); err != nil || got != want {
+			t.Errorf("ParseMergeStrategy(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"merge:", "union"} {
+		if _, err := ParseMergeStrategy(s); !errors.Is(err, ErrInvalidMergeStrategy) {
+			t.Errorf("ParseMergeStrategy(%q) error = %v, want %v", s, err, ErrInvalidMergeStrategy)
+		}
+	}
+
+	if err := New().MergeConfigMap(map[string]interface{}{"$merge": "append"}); !errors.Is(err, ErrInvalidMergeStrategy) {
+		t.Errorf("MergeConfigMap error = %v, want %v", err, ErrInvalidMergeStrategy)
+	}
+}
+
+func TestMergeReload(t *testing.T) {
+	h := New()
+	h.SetDefault("hooks", []interface{}{"stdout"})
+	h.SetProfiles("prod")
+
+	assetMap := map[string][]byte{
+		"app.yaml":      []byte("$merge: {hooks: append}\nhooks: [file]\n"),
+		"app.prod.yaml": []byte("$merge: {hooks: prepend}\nhooks: [syslog]\n"),
+	}
+
+	want := []interface{}{"syslog", "stdout", "file"}
+
+	for i := 0; i < 3; i++ {
+		if err := h.LoadAssetMap(assetMap); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := h.Get("hooks"); !reflect.DeepEqual(got, want) {
+			t.Errorf("hooks after load %d = %v, want %v", i+1, got, want)
+		}
+	}
+
+	// Reloading the base asset alone merges it over the defaults again.
+	if err := h.LoadAssetMap(map[string][]byte{"app.yaml": assetMap["app.yaml"]}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := h.Get("hooks"), []interface{}{"stdout", "file"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hooks after reloading app.yaml = %v, want %v", got, want)
+	}
+
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(file, assetMap["app.yaml"], 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h = New()
+	h.SetDefault("hooks", []interface{}{"stdout"})
+	h.SetConfigFile(file)
+
+	for i := 0; i < 3; i++ {
+		if err := h.ReadInConfig(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := h.Get("hooks"), []interface{}{"stdout", "file"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hooks after reading the file 3 times = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,240 @@
+package hierarchy
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	// ProfilesEnv lists the active profiles, comma separated, when none are set explicitly.
+	ProfilesEnv = "LIBRA_PROFILES"
+	// ProfilesFlag is the flag registered by AddProfilesFlag and read by LoadFlags.
+	ProfilesFlag = "profiles"
+	// profilesKey holds in-file sections merged over the file when their profile is active.
+	profilesKey = "profiles"
+)
+
+// AddProfilesFlag registers the --profiles flag on flags.
+func AddProfilesFlag(flags *pflag.FlagSet) {
+	flags.StringSlice(ProfilesFlag, nil, "active configuration profiles, in merge order")
+}
+
+func SetProfiles(profiles ...string) {
+	_default.SetProfiles(profiles...)
+}
+
+// SetProfiles sets the active profiles used by later loads, overriding LIBRA_PROFILES.
+func (h *Hierarchy) SetProfiles(profiles ...string) {
+	if h.root != nil {
+		h.root.SetProfiles(profiles...)
+
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.profiles = make([]string, 0, len(profiles))
+	h.profiles = append(h.profiles, profiles...)
+}
+
+func Profiles() []string {
+	return _default.Profiles()
+}
+
+// Profiles returns the active profiles in merge order.
+func (h *Hierarchy) Profiles() []string {
+	if h.root != nil {
+		return h.root.Profiles()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.profiles != nil {
+		return append([]string{}, h.profiles...)
+	}
+
+	return splitProfiles(os.Getenv(ProfilesEnv))
+}
+
+func IsProfileActive(profile string) bool {
+	return _default.IsProfileActive(profile)
+}
+
+// IsProfileActive reports whether profile is one of the active profiles.
+func (h *Hierarchy) IsProfileActive(profile string) bool {
+	for _, active := range h.Profiles() {
+		if active == profile {
+			return true
+		}
+	}
+
+	return false
+}
+
+func DeclareProfiles(patterns ...string) {
+	_default.DeclareProfiles(patterns...)
+}
+
+// DeclareProfiles declares the profiles that may be active, as patterns matching their
+// names such as `prod` or `pr-*`, see LoadAssetMap. Active profiles need no declaring.
+func (h *Hierarchy) DeclareProfiles(patterns ...string) {
+	if h.root != nil {
+		h.root.DeclareProfiles(patterns...)
+
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.declaredProfiles = append(h.declaredProfiles, patterns...)
+}
+
+// isProfile returns whether a name is one of the active profiles or a declared profile.
+func (h *Hierarchy) isProfile(active []string) func(name string) bool {
+	base := h.base()
+
+	base.mu.Lock()
+	declared := append([]string{}, base.declaredProfiles...)
+	base.mu.Unlock()
+
+	return func(name string) bool {
+		for _, profile := range active {
+			if strings.EqualFold(profile, name) {
+				return true
+			}
+		}
+
+		for _, pattern := range declared {
+			if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); ok {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+func splitProfiles(s string) []string {
+	profiles := make([]string, 0)
+
+	for _, profile := range strings.Split(s, ",") {
+		if profile = strings.TrimSpace(profile); profile != "" {
+			profiles = append(profiles, profile)
+		}
+	}
+
+	return profiles
+}
+
+// assetProfile returns the profile of a profile-suffixed asset such as app.prod.yaml: its
+// suffix is a profile when the bundle holds the asset without it, app.yaml, or when it is
+// a profile. Other dotted names, e.g. foo.v2.json without foo.json, are base assets.
+func assetProfile(name string, assetMap map[string][]byte, isProfile func(string) bool) string {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	index := strings.LastIndex(stem, ".")
+	if index <= strings.LastIndex(stem, "/")+1 {
+		return ""
+	}
+
+	profile := stem[index+1:]
+	if _, ok := assetMap[stem[:index]+ext]; ok || isProfile(profile) {
+		return profile
+	}
+
+	return ""
+}
+
+// orderAssets returns the base assets sorted by name, followed by the assets of each
+// active profile in profile order, and the assets of inactive profiles, which are left out.
+func orderAssets(assetMap map[string][]byte, profiles []string, isProfile func(string) bool) ([]string, []string) {
+	byProfile := make(map[string][]string)
+
+	for name := range assetMap {
+		profile := strings.ToLower(assetProfile(name, assetMap, isProfile))
+		byProfile[profile] = append(byProfile[profile], name)
+	}
+
+	names := make([]string, 0, len(assetMap))
+	for _, profile := range append([]string{""}, profiles...) {
+		profile = strings.ToLower(profile)
+		profileNames := byProfile[profile]
+		sort.Strings(profileNames)
+		names = append(names, profileNames...)
+
+		delete(byProfile, profile)
+	}
+
+	var skipped []string
+	for _, profileNames := range byProfile {
+		skipped = append(skipped, profileNames...)
+	}
+
+	sort.Strings(skipped)
+
+	return names, skipped
+}
+
+// applyProfileSections merges the `profiles.<name>` sections of settings for each
+// active profile, in order, and removes the profiles key.
+func applyProfileSections(settings map[string]interface{}, profiles []string) map[string]interface{} {
+	sections, ok := settings[profilesKey].(map[string]interface{})
+	if !ok {
+		return settings
+	}
+
+	delete(settings, profilesKey)
+
+	for _, profile := range profiles {
+		if section, ok := lookupFold(sections, profile); ok {
+			if m, ok := section.(map[string]interface{}); ok {
+				mergeTree(settings, m, true)
+			}
+		}
+	}
+
+	return settings
+}
+
+// applyProfilePaths moves what is known about the paths of the active `profiles.<name>`
+// sections to the paths they are merged into, and drops the others.
+func applyProfilePaths[T any](m map[string]T, profiles []string) map[string]T {
+	applied := make(map[string]T, len(m))
+
+	for key, value := range m {
+		if !strings.HasPrefix(key, profilesKey+".") {
+			applied[key] = value
+		}
+	}
+
+	for _, profile := range profiles {
+		prefix := profilesKey + "." + strings.ToLower(profile) + "."
+
+		for key, value := range m {
+			if strings.HasPrefix(key, prefix) {
+				applied[strings.TrimPrefix(key, prefix)] = value
+			}
+		}
+	}
+
+	return applied
+}
+
+// assetOrigin returns the origins of an asset's keys, defaulting to the asset without line.
+func assetOrigin(name string, origins map[string]Origin) func(string) Origin {
+	return func(path string) Origin {
+		if origin, ok := origins[path]; ok {
+			return origin
+		}
+
+		return Origin{Kind: SourceAsset, Name: name}
+	}
+}
@@ -0,0 +1,91 @@
+package hierarchy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOrderAssets(t *testing.T) {
+	assetMap := map[string][]byte{
+		"app.yaml":          nil,
+		"app.config.yaml":   nil,
+		"foo.v2.json":       nil,
+		"app.prod.yaml":     nil,
+		"app.dev.yaml":      nil,
+		"db.prod.yaml":      nil,
+		"app.PR-12.yaml":    nil,
+		"base.staging.yaml": nil,
+	}
+
+	h := New()
+	h.DeclareProfiles("dev", "pr-*")
+
+	profiles := []string{"staging", "prod"}
+	names, skipped := orderAssets(assetMap, profiles, h.isProfile(profiles))
+
+	want := []string{"app.yaml", "foo.v2.json", "base.staging.yaml", "app.prod.yaml", "db.prod.yaml"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+
+	// app.config.yaml is the asset of a config profile, as app.yaml exists.
+	if want := []string{"app.PR-12.yaml", "app.config.yaml", "app.dev.yaml"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped = %v, want %v", skipped, want)
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	h := New()
+	h.SetProfiles("prod")
+	h.DeclareProfiles("dev")
+
+	if err := h.LoadAssetMap(map[string][]byte{
+		"app.yaml":        []byte("level: info\nname: api\nprofiles:\n  prod: {replicas: 3}\n  dev: {replicas: 1}\n"),
+		"app.prod.yaml":   []byte("level: warn\n"),
+		"app.dev.yaml":    []byte("level: debug\n"),
+		"workers.v2.yaml": []byte("workers: 4\n"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]interface{}{"level": "warn", "name": "api", "replicas": 3, "workers": 4}
+	for key, want := range tests {
+		if got := h.Get(key); got != want {
+			t.Errorf("Get(%s) = %#v, want %#v", key, got, want)
+		}
+	}
+
+	if h.IsSet("profiles") {
+		t.Error("profiles sections are still set")
+	}
+}
+
+func TestLoadInactiveProfiles(t *testing.T) {
+	assetMap := map[string][]byte{
+		"app.yaml":         []byte("level: info\n"),
+		"app.staging.yaml": []byte("level: debug\nstaging_only: true\n"),
+		"app.prod.yaml":    []byte("level: warn\nprod_only: true\n"),
+	}
+
+	tests := []struct {
+		profiles []string
+		want     map[string]interface{}
+	}{
+		{want: map[string]interface{}{"level": "info"}},
+		{profiles: []string{"staging"}, want: map[string]interface{}{"level": "debug", "staging_only": true}},
+		{profiles: []string{"prod"}, want: map[string]interface{}{"level": "warn", "prod_only": true}},
+	}
+
+	for _, test := range tests {
+		h := New()
+		h.SetProfiles(test.profiles...)
+
+		if err := h.LoadAssetMap(assetMap); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := h.AllSettings(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("profiles %v: settings = %v, want %v", test.profiles, got, test.want)
+		}
+	}
+}
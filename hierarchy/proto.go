@@ -0,0 +1,402 @@
+package hierarchy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// WithProtoMessage parses the protobuf assets, in text format with the .textproto, .txtpb
+// or .pbtxt extension or binary with .pb or .binpb, as messages of the type of msg, named
+// after their fields. They are parsed as google.protobuf.Struct messages by default, as
+// written by Export and MarshalProto.
+func WithProtoMessage(msg proto.Message) LoadOption {
+	return func(l *loader) {
+		l.protoMessage = msg
+	}
+}
+
+// parseProto parses a protobuf asset into settings.
+func (l *loader) parseProto(data []byte, text bool) (interface{}, error) {
+	var msg proto.Message = &structpb.Struct{}
+	if l.protoMessage != nil {
+		msg = l.protoMessage.ProtoReflect().New().Interface()
+	}
+
+	var err error
+	if text {
+		err = prototext.Unmarshal(data, msg)
+	} else {
+		err = proto.Unmarshal(data, msg)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if s, ok := msg.(*structpb.Struct); ok {
+		return structSettings(s), nil
+	}
+
+	data, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var settings interface{}
+	if err := decoder.Decode(&settings); err != nil {
+		return nil, err
+	}
+
+	return messageInts(msg.ProtoReflect().Descriptor(), structValue(settings)), nil
+}
+
+// messageInts turns the 64-bit integer fields of md, which protojson writes as strings,
+// back into numbers in value, the JSON form of a message.
+func messageInts(md protoreflect.MessageDescriptor, value interface{}) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok || isWellKnown(md) {
+		// Well-known types have their own JSON forms; wrappers of 64-bit integers are
+		// decoded by fieldInts.
+		return value
+	}
+
+	fields := md.Fields()
+
+	for key, child := range m {
+		fd := fields.ByName(protoreflect.Name(key))
+		if fd == nil {
+			continue
+		}
+
+		field := func(value interface{}) interface{} {
+			return fieldInts(fd, value)
+		}
+		if fd.IsMap() {
+			field = func(value interface{}) interface{} {
+				return fieldInts(fd.MapValue(), value)
+			}
+		}
+
+		switch v := child.(type) {
+		case []interface{}:
+			for index, item := range v {
+				v[index] = field(item)
+			}
+		case map[string]interface{}:
+			if fd.IsMap() {
+				for k, item := range v {
+					v[k] = field(item)
+				}
+			} else {
+				m[key] = field(v)
+			}
+		default:
+			m[key] = field(v)
+		}
+	}
+
+	return m
+}
+
+// fieldInts turns value back into a number if fd is a 64-bit integer field.
+func fieldInts(fd protoreflect.FieldDescriptor, value interface{}) interface{} {
+	kind := fd.Kind()
+
+	if kind == protoreflect.MessageKind || kind == protoreflect.GroupKind {
+		switch fd.Message().FullName() {
+		case "google.protobuf.Int64Value":
+			kind = protoreflect.Int64Kind
+		case "google.protobuf.UInt64Value":
+			kind = protoreflect.Uint64Kind
+		default:
+			return messageInts(fd.Message(), value)
+		}
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+
+	switch kind {
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return int(i)
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return int(i)
+		}
+
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return u
+		}
+	}
+
+	return value
+}
+
+// isWellKnown reports whether md is one of the well-known types, such as
+// google.protobuf.Duration, and not a message of descriptor.proto.
+func isWellKnown(md protoreflect.MessageDescriptor) bool {
+	return md.ParentFile() != nil && md.ParentFile().Package() == "google.protobuf" &&
+		md.ParentFile().Path() != "google/protobuf/descriptor.proto"
+}
+
+// integersKey lists the paths of the integers encoded as strings by MarshalProto.
+const integersKey = "$integers"
+
+// maxExactInt is the largest integer a float64, the only number of structpb, holds exactly.
+const maxExactInt = 1 << 53
+
+// structValue turns the numbers decoded from a Struct or JSON back into ints when they
+// are whole, like the other asset formats decode them.
+func structValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) <= maxExactInt {
+			return int(v)
+		}
+
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+
+		f, _ := v.Float64()
+
+		return f
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = structValue(child)
+		}
+
+		return v
+	case []interface{}:
+		for index, child := range v {
+			v[index] = structValue(child)
+		}
+
+		return v
+	default:
+		return value
+	}
+}
+
+func ToStruct() (*structpb.Struct, error) {
+	return _default.ToStruct()
+}
+
+// ToStruct returns the resolved settings as a google.protobuf.Struct. Durations are
+// encoded like google.protobuf.Duration, e.g. `1.5s`, times in RFC 3339 and byte sizes in bytes.
+// Integers beyond 2^53, which the float64 numbers of a Struct would round, are encoded as
+// decimal strings.
+func (h *Hierarchy) ToStruct() (*structpb.Struct, error) {
+	m, _ := protoValue(h.AllSettings()).(map[string]interface{})
+
+	return structpb.NewStruct(m)
+}
+
+func MarshalProto() ([]byte, error) {
+	return _default.MarshalProto()
+}
+
+// MarshalProto encodes the resolved settings as a binary google.protobuf.Struct, see
+// ToStruct, to send a snapshot of the hierarchy. Snapshot copies one in memory. The paths
+// of the integers encoded as strings are listed under the `$integers` key, so that
+// UnmarshalProto and LoadAssetMap decode them as integers again.
+func (h *Hierarchy) MarshalProto() ([]byte, error) {
+	s, err := h.snapshotStruct()
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.MarshalOptions{Deterministic: true}.Marshal(s)
+}
+
+// snapshotStruct is like ToStruct, listing the integers encoded as strings.
+func (h *Hierarchy) snapshotStruct() (*structpb.Struct, error) {
+	settings := h.AllSettings()
+
+	m, _ := protoValue(settings).(map[string]interface{})
+
+	var integers []interface{}
+	collectLargeInts(nil, settings, &integers)
+
+	if len(integers) > 0 {
+		m[integersKey] = integers
+	}
+
+	return structpb.NewStruct(m)
+}
+
+// UnmarshalProto returns a new hierarchy holding the settings encoded by MarshalProto.
+// Whole numbers are decoded as ints, like in the other asset formats.
+func UnmarshalProto(data []byte, opts ...Option) (*Hierarchy, error) {
+	var s structpb.Struct
+	if err := proto.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+
+	h := New(opts...)
+	h.hold(structSettings(&s))
+
+	return h, nil
+}
+
+// structSettings returns the settings of s, with whole numbers and the integers listed
+// by MarshalProto decoded as integers.
+func structSettings(s *structpb.Struct) map[string]interface{} {
+	settings, _ := structValue(s.AsMap()).(map[string]interface{})
+
+	integers, _ := settings[integersKey].([]interface{})
+	delete(settings, integersKey)
+
+	for _, integer := range integers {
+		path := splitPath(fmt.Sprint(integer))
+
+		value, _ := lookupPath(settings, path)
+		if n, err := parseInt(fmt.Sprint(value)); err == nil {
+			_, _ = setIn(settings, path, n)
+		}
+	}
+
+	return settings
+}
+
+// collectLargeInts collects the paths of the integers under value, at prefix, that ToStruct
+// encodes as strings.
+func collectLargeInts(prefix []string, value interface{}, paths *[]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			collectLargeInts(append(prefix[:len(prefix):len(prefix)], key), child, paths)
+		}
+	case []interface{}:
+		for index, child := range v {
+			collectLargeInts(append(prefix[:len(prefix):len(prefix)], strconv.Itoa(index)), child, paths)
+		}
+	default:
+		if rv := reflect.ValueOf(value); rv.CanInt() || rv.CanUint() {
+			if _, ok := protoValue(value).(string); ok {
+				*paths = append(*paths, strings.Join(prefix, "."))
+			}
+		}
+	}
+}
+
+func DecodeProto(key string, msg proto.Message) error {
+	return _default.DecodeProto(key, msg)
+}
+
+// DecodeProto decodes the resolved subtree at key, or the whole hierarchy if key is empty,
+// into msg, typically a generated message. Keys match the proto or JSON names of fields,
+// so lowercased keys match snake_case proto names only, unless the hierarchy preserves
+// case. Keys matching no field are ignored.
+func (h *Hierarchy) DecodeProto(key string, msg proto.Message) error {
+	var value interface{} = h.AllSettings()
+	if key != "" {
+		value = h.Get(key)
+	}
+
+	data, err := json.Marshal(protoValue(value))
+	if err != nil {
+		return err
+	}
+
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	return nil
+}
+
+// protoValue converts the values that structpb and protojson cannot encode.
+func protoValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Duration:
+		return strconv.FormatFloat(v.Seconds(), 'f', -1, 64) + "s"
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case ByteSize:
+		return protoValue(uint64(v))
+	case int:
+		return protoInt(int64(v))
+	case int64:
+		return protoInt(v)
+	case uint:
+		return protoUint(uint64(v))
+	case uint64:
+		return protoUint(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[key] = protoValue(child)
+		}
+
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for index, child := range v {
+			items[index] = protoValue(child)
+		}
+
+		return items
+	case nil, string, bool, int32, uint32, float32, float64, []byte:
+		return value
+	default:
+		if m, ok := toStringMap(value); ok {
+			return protoValue(m)
+		}
+
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+			items := make([]interface{}, rv.Len())
+			for index := range items {
+				items[index] = protoValue(rv.Index(index).Interface())
+			}
+
+			return items
+		}
+
+		// Other numbers are converted through JSON, anything else is encoded as a string.
+		var converted interface{}
+		if data, err := json.Marshal(value); err == nil && json.Unmarshal(data, &converted) == nil {
+			return converted
+		}
+
+		return fmt.Sprint(value)
+	}
+}
+
+// protoInt keeps i a number unless a float64 would round it.
+func protoInt(i int64) interface{} {
+	if i < -maxExactInt || i > maxExactInt {
+		return strconv.FormatInt(i, 10)
+	}
+
+	return i
+}
+
+func protoUint(u uint64) interface{} {
+	if u > maxExactInt {
+		return strconv.FormatUint(u, 10)
+	}
+
+	return u
+}
@@ -0,0 +1,151 @@
+package hierarchy
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestProtoIntegers(t *testing.T) {
+	h := New()
+	h.Set("port", 8080)
+	h.Set("big", int64(1<<53+1))
+	h.Set("max", uint64(math.MaxUint64))
+	h.Set("ratio", 1.5)
+	h.Set("ports", []interface{}{80, 443})
+	h.Set("id", "9007199254740993")
+
+	data, err := h.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := UnmarshalProto(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]interface{}{
+		"port":  8080,
+		"big":   1<<53 + 1,
+		"max":   uint64(math.MaxUint64),
+		"ratio": 1.5,
+		"ports": []interface{}{80, 443},
+		"id":    "9007199254740993",
+	}
+	for key, want := range tests {
+		if got := decoded.Get(key); !reflect.DeepEqual(got, want) {
+			t.Errorf("Get(%s) = %#v, want %#v", key, got, want)
+		}
+	}
+
+	if decoded.IsSet(integersKey) {
+		t.Errorf("%s is set", integersKey)
+	}
+
+	for _, name := range []string{"app.pb", "app.textproto"} {
+		exported, err := h.Export(name[4:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		loaded := New()
+		if err := loaded.LoadAssetMap(map[string][]byte{name: exported}); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := loaded.Get("max"); got != uint64(math.MaxUint64) || loaded.IsSet(integersKey) {
+			t.Errorf("%s: max = %#v, want %d", name, got, uint64(math.MaxUint64))
+		}
+	}
+}
+
+func TestLoadProtoMessage(t *testing.T) {
+	h := New()
+	if err := h.LoadAssetMap(map[string][]byte{
+		"app.textproto": []byte(`fields { key: "port" value { number_value: 8080 } }`),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := h.Get("port"); got != 8080 {
+		t.Errorf("port = %#v, want 8080", got)
+	}
+
+	h = New()
+	if err := h.LoadAssetMap(map[string][]byte{
+		"option.txtpb": []byte("positive_int_value: 18446744073709551615\nnegative_int_value: -5\ndouble_value: 2.5\n"),
+	}, WithProtoMessage(&descriptorpb.UninterpretedOption{})); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]interface{}{
+		"positive_int_value": uint64(math.MaxUint64),
+		"negative_int_value": -5,
+		"double_value":       2.5,
+	}
+	for key, want := range tests {
+		if got := h.Get(key); got != want {
+			t.Errorf("Get(%s) = %#v, want %#v", key, got, want)
+		}
+	}
+}
+
+func BenchmarkSnapshot(b *testing.B) {
+	h := New()
+	if err := h.LoadAssetMap(versionAsset(1000, 0)); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_ = h.Snapshot("")
+	}
+}
+
+func BenchmarkProtoRoundTrip(b *testing.B) {
+	h := New()
+	if err := h.LoadAssetMap(versionAsset(1000, 0)); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		data, err := h.MarshalProto()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := UnmarshalProto(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSONRoundTrip(b *testing.B) {
+	h := New()
+	if err := h.LoadAssetMap(versionAsset(1000, 0)); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		data, err := json.Marshal(h.AllSettings())
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		var settings map[string]interface{}
+		if err := json.Unmarshal(data, &settings); err != nil {
+			b.Fatal(err)
+		}
+
+		New().hold(settings)
+	}
+}
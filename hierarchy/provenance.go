@@ -0,0 +1,263 @@
+package hierarchy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// SourceKind tells which kind of source set a value.
+type SourceKind string
+
+const (
+	SourceDefault SourceKind = "default"
+	SourceAsset   SourceKind = "asset"
+	SourceMerge   SourceKind = "merge"
+	SourceEnv     SourceKind = "env"
+	SourceFlag    SourceKind = "flag"
+	SourceSet     SourceKind = "set"
+)
+
+// precedence ranks source kinds, the higher one winning.
+var precedence = map[SourceKind]int{
+	SourceDefault: 0,
+	SourceAsset:   1,
+	SourceMerge:   1,
+	SourceEnv:     2,
+	SourceFlag:    3,
+	SourceSet:     4,
+}
+
+// Origin is a source that set a key.
+type Origin struct {
+	Kind SourceKind
+	// Name is the asset name, env var, flag or call site of SetDefault, Set or MergeConfigMap.
+	Name string
+	// Line is the line in the asset, or 0 when unknown.
+	Line    int
+	Value   interface{}
+	Deleted bool
+}
+
+func (o Origin) String() string {
+	name := o.Name
+	if o.Line > 0 {
+		name = fmt.Sprintf("%s:%d", name, o.Line)
+	}
+
+	if o.Deleted {
+		return fmt.Sprintf("%s %s (deleted)", o.Kind, name)
+	}
+
+	return fmt.Sprintf("%s %s", o.Kind, name)
+}
+
+// Explanation lists the sources that set a key, from lowest to highest precedence.
+type Explanation struct {
+	Key     string
+	Value   interface{}
+	Origins []Origin
+	// Winner is the index in Origins of the source the value comes from, or -1.
+	Winner int
+}
+
+func (e *Explanation) String() string {
+	var buf strings.Builder
+
+	fmt.Fprintf(&buf, "%s = %v", e.Key, e.Value)
+
+	for index := len(e.Origins) - 1; index >= 0; index-- {
+		mark := "overridden"
+		if index == e.Winner {
+			mark = "winner"
+		}
+
+		fmt.Fprintf(&buf, "\n  %-10s %s = %v", mark, e.Origins[index], e.Origins[index].Value)
+	}
+
+	return buf.String()
+}
+
+// record remembers that origin set every leaf of value at key. An origin replaces the one
+// of the same source, e.g. the same asset reloaded or the same call site of Set, so that
+// origins do not grow with reloads.
+func (l *layers) record(key string, value interface{}, origin func(path string) Origin) {
+	m, ok := value.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		o := origin(key)
+		o.Value = value
+		o.Deleted = isTombstone(value)
+
+		if o.Deleted {
+			o.Value = nil
+		}
+
+		origins := make([]Origin, 0, len(l.origins[key])+1)
+
+		for _, previous := range l.origins[key] {
+			if previous.Kind != o.Kind || previous.Name != o.Name {
+				origins = append(origins, previous)
+			}
+		}
+
+		l.origins[key] = append(origins, o)
+
+		return
+	}
+
+	for child, childValue := range m {
+		l.record(joinPath(key, child), childValue, origin)
+	}
+}
+
+// callSite returns the first caller outside of this package, as dir/file.go:line.
+func callSite() string {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/cloudlibraries/libra/hierarchy.") {
+			dir := filepath.Base(filepath.Dir(frame.File))
+
+			return fmt.Sprintf("%s/%s:%d", dir, filepath.Base(frame.File), frame.Line)
+		}
+
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+func callOrigin(kind SourceKind) func(string) Origin {
+	site := callSite()
+
+	return func(string) Origin {
+		return Origin{Kind: kind, Name: site}
+	}
+}
+
+func Explain(key string) *Explanation {
+	return _default.Explain(key)
+}
+
+// Explain returns the sources that set key and which one won. For keys inside an
+// array, or set as part of a bigger value, the sources of the closest parent are given.
+// The values of sensitive keys are redacted, see MarkSensitive.
+func (h *Hierarchy) Explain(key string) *Explanation {
+	if h.root != nil {
+		e := h.root.Explain(h.absolute(key))
+		e.Key = key
+
+		return e
+	}
+
+	e := &Explanation{Key: key, Value: h.Get(key), Winner: -1}
+	recorded := h.current.Load().origins
+
+	for path := strings.Join(splitKey(key), "."); ; {
+		e.Origins = append([]Origin{}, recorded[path]...)
+		if len(e.Origins) > 0 {
+			break
+		}
+
+		index := strings.LastIndex(path, ".")
+		if index < 0 {
+			break
+		}
+
+		path = path[:index]
+	}
+
+	sort.SliceStable(e.Origins, func(i, j int) bool {
+		return precedence[e.Origins[i].Kind] < precedence[e.Origins[j].Kind]
+	})
+
+	if last := len(e.Origins) - 1; last >= 0 && !e.Origins[last].Deleted {
+		e.Winner = last
+	}
+
+	// Values holding arrays or maps may have sensitive keys inside.
+	s, path := h.sensitivity(), splitKey(key)
+	e.Value = s.redact(path, e.Value)
+
+	for index := range e.Origins {
+		e.Origins[index].Value = s.redact(path, e.Origins[index].Value)
+	}
+
+	return e
+}
+
+func ExplainAll() []*Explanation {
+	return _default.ExplainAll()
+}
+
+// ExplainAll explains every key of the hierarchy.
+func (h *Hierarchy) ExplainAll() []*Explanation {
+	keys := h.AllKeys()
+	explanations := make([]*Explanation, 0, len(keys))
+
+	for _, key := range keys {
+		explanations = append(explanations, h.Explain(key))
+	}
+
+	return explanations
+}
+
+func Annotated() string {
+	return _default.Annotated()
+}
+
+// Annotated dumps every key with its value and the source it comes from, with sensitive
+// values redacted.
+func (h *Hierarchy) Annotated() string {
+	var buf strings.Builder
+
+	for _, e := range h.ExplainAll() {
+		fmt.Fprintf(&buf, "%s: %v", e.Key, e.Value)
+
+		if e.Winner >= 0 {
+			fmt.Fprintf(&buf, "  # %s", e.Origins[e.Winner])
+
+			if overridden := len(e.Origins) - 1; overridden > 0 {
+				fmt.Fprintf(&buf, ", overrides %d", overridden)
+			}
+		}
+
+		buf.WriteByte('\n')
+	}
+
+	return buf.String()
+}
+
+// Debug prints the sources of the hierarchy to stdout, see DebugTo.
+func (h *Hierarchy) Debug() {
+	h.DebugTo(os.Stdout)
+}
+
+// DebugTo prints the aliases and the layers of the hierarchy, from highest to lowest
+// precedence, with sensitive values redacted.
+func (h *Hierarchy) DebugTo(w io.Writer) {
+	b := h.base()
+	l, s := b.current.Load(), b.sensitivity()
+
+	fmt.Fprintf(w, "Aliases:\n%#v\n", l.aliases)
+
+	for _, layer := range []struct {
+		name   string
+		values map[string]interface{}
+	}{
+		{name: "Override", values: l.override},
+		{name: "Flags", values: l.flags},
+		{name: "Env", values: l.env},
+		{name: "Config", values: l.config},
+		{name: "Defaults", values: l.defaults},
+		{name: "Flag defaults", values: l.flagDefaults},
+	} {
+		fmt.Fprintf(w, "%s:\n%v\n", layer.name, s.redact(nil, layer.values))
+	}
+}
@@ -0,0 +1,84 @@
+package hierarchy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestExplain(t *testing.T) {
+	t.Setenv("PROVTEST_LEVEL", "warn")
+
+	asset := map[string][]byte{"app.yaml": []byte("name: api\nlevel: info\n")}
+
+	h := New()
+	h.SetDefault("level", "debug")
+
+	if err := h.LoadAssetMap(asset); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.LoadEnv("PROVTEST"); err != nil {
+		t.Fatal(err)
+	}
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("level", "", "")
+
+	if err := flags.Parse([]string{"--level=error"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.BindPFlag("level", flags.Lookup("level")); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Set("level", "fatal")
+
+	e := h.Explain("level")
+
+	// Call sites are outside of the package, which has the tests too.
+	want := []string{"default ", "asset app.yaml:2", "env PROVTEST_LEVEL", "flag --level", "set "}
+	if len(e.Origins) != len(want) {
+		t.Fatalf("Explain(level) = %s, want %d origins", e, len(want))
+	}
+
+	for index, origin := range e.Origins {
+		if !strings.HasPrefix(origin.String(), want[index]) {
+			t.Errorf("origin %d = %s, want %s", index, origin, want[index])
+		}
+	}
+
+	if e.Value != "fatal" || e.Winner != 4 || e.Origins[2].Value != "warn" {
+		t.Errorf("Explain(level) = %s, want set to win with fatal", e)
+	}
+
+	h.Delete("level")
+
+	if e := h.Explain("level"); e.Winner != -1 || !e.Origins[len(e.Origins)-1].Deleted || e.Value != nil {
+		t.Errorf("Explain(level) after Delete = %s, want no winner", e)
+	}
+
+	if got := h.Annotated(); !strings.Contains(got, "name: api  # asset app.yaml:1\n") {
+		t.Errorf("Annotated =\n%s\nwant name from app.yaml:1", got)
+	}
+}
+
+func TestExplainReloads(t *testing.T) {
+	h := New()
+
+	for i := 0; i < 3; i++ {
+		if err := h.LoadAssetMap(map[string][]byte{"app.yaml": []byte("name: api\n")}); err != nil {
+			t.Fatal(err)
+		}
+
+		h.Set("level", i)
+	}
+
+	for _, key := range []string{"name", "level"} {
+		if origins := h.Explain(key).Origins; len(origins) != 1 {
+			t.Errorf("Explain(%s) has %d origins after 3 loads, want 1", key, len(origins))
+		}
+	}
+}
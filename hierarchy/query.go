@@ -0,0 +1,96 @@
+package hierarchy
+
+import (
+	"encoding/json"
+
+	"github.com/tidwall/gjson"
+)
+
+// QueryResult is what a query matched.
+type QueryResult struct {
+	h      *Hierarchy
+	result gjson.Result
+}
+
+func Query(query string) QueryResult {
+	return _default.Query(query)
+}
+
+// Query runs a gjson query against the resolved settings, e.g. `logger.hooks.#.type` for the
+// type of every hook, `logger.hooks.#(type=="file")` for the first file hook,
+// `logger.hooks.#(levels.#(=="error"))#` for all hooks logging errors, `logger.*.level`
+// for wildcards and `logger.hooks.#.{type,level}` for projections. Keys match the case of
+// JSON, which is lowercase unless the hierarchy preserves case.
+func (h *Hierarchy) Query(query string) QueryResult {
+	data, err := json.Marshal(h.AllSettings())
+	if err != nil {
+		return QueryResult{h: h}
+	}
+
+	return QueryResult{h: h, result: gjson.GetBytes(data, query)}
+}
+
+// Exists reports whether the query matched.
+func (r QueryResult) Exists() bool {
+	return r.result.Exists()
+}
+
+// Value returns the matched value: a map, an array, a string, a float64, a bool or nil.
+func (r QueryResult) Value() interface{} {
+	return r.result.Value()
+}
+
+// String returns a matched scalar as a string, or the JSON of a matched map or array.
+func (r QueryResult) String() string {
+	return r.result.String()
+}
+
+// IsArray reports whether the query matched an array, as filters ending with # do.
+func (r QueryResult) IsArray() bool {
+	return r.result.IsArray()
+}
+
+// IsMap reports whether the query matched a map.
+func (r QueryResult) IsMap() bool {
+	return r.result.IsObject()
+}
+
+// Array returns the items of a matched array, or the matched value as a single item.
+func (r QueryResult) Array() []QueryResult {
+	items := r.result.Array()
+	results := make([]QueryResult, 0, len(items))
+
+	for _, item := range items {
+		results = append(results, QueryResult{h: r.h, result: item})
+	}
+
+	return results
+}
+
+// Hierarchy returns a detached hierarchy holding a matched map, or nil.
+func (r QueryResult) Hierarchy() *Hierarchy {
+	m, ok := r.result.Value().(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	return r.h.detached(m)
+}
+
+// Hierarchies returns a detached hierarchy for each map matched, skipping other values.
+func (r QueryResult) Hierarchies() []*Hierarchy {
+	hierarchies := make([]*Hierarchy, 0)
+
+	for _, item := range r.Array() {
+		if h := item.Hierarchy(); h != nil {
+			hierarchies = append(hierarchies, h)
+		}
+	}
+
+	return hierarchies
+}
+
+// Decode decodes the matched value into v, like Decode does with a hierarchy.
+func (r QueryResult) Decode(v interface{}) error {
+	return decode(r.result.Value(), v)
+}
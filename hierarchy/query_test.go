@@ -0,0 +1,80 @@
+package hierarchy
+
+import (
+	"reflect"
+	"testing"
+)
+
+const queryYAML = `logger:
+  console: {level: info}
+  hooks:
+    - {type: file, level: info, levels: [info, error]}
+    - {type: stdout, level: debug, levels: [debug]}
+    - {type: file, level: warn, levels: [error]}
+`
+
+func TestQuery(t *testing.T) {
+	h := New()
+	if err := h.LoadAssetMap(map[string][]byte{"app.yaml": []byte(queryYAML)}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]interface{}{
+		`logger.hooks.#.type`:                        []interface{}{"file", "stdout", "file"},
+		`logger.hooks.#(type=="file").level`:         "info",
+		`logger.hooks.#(type=="file")#.level`:        []interface{}{"info", "warn"},
+		`logger.hooks.#(levels.#(=="error"))#.level`: []interface{}{"info", "warn"},
+		`logger.*.level`:                             "info",
+		`logger.hooks.1.{type,level}`:                map[string]interface{}{"type": "stdout", "level": "debug"},
+		`logger.hooks.#`:                             float64(3),
+	}
+	for query, want := range tests {
+		if got := h.Query(query).Value(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Query(%s) = %#v, want %#v", query, got, want)
+		}
+	}
+
+	if h.Query("logger.missing").Exists() {
+		t.Error("Query(logger.missing) exists")
+	}
+}
+
+func TestQueryHierarchies(t *testing.T) {
+	h := New()
+	if err := h.LoadAssetMap(map[string][]byte{"app.yaml": []byte(queryYAML)}); err != nil {
+		t.Fatal(err)
+	}
+
+	result := h.Query(`logger.hooks.#(type=="file")#`)
+	if !result.IsArray() || len(result.Array()) != 2 {
+		t.Fatalf("Query = %s, want 2 file hooks", result)
+	}
+
+	hooks := result.Hierarchies()
+	if len(hooks) != 2 || hooks[1].GetString("level") != "warn" {
+		t.Fatalf("Hierarchies = %v, want 2 with the last at warn", hooks)
+	}
+
+	// Detached hierarchies do not write through.
+	hooks[1].Set("level", "error")
+
+	if got := h.GetString("logger.hooks.2.level"); got != "warn" {
+		t.Errorf("logger.hooks.2.level = %q after setting a detached copy, want warn", got)
+	}
+
+	if h.Query("logger.hooks.0.type").Hierarchy() != nil {
+		t.Error("Hierarchy of a string is not nil")
+	}
+
+	var hook struct {
+		Type   string
+		Levels []string
+	}
+	if err := h.Query("logger.hooks.0").Decode(&hook); err != nil {
+		t.Fatal(err)
+	}
+
+	if hook.Type != "file" || !reflect.DeepEqual(hook.Levels, []string{"info", "error"}) {
+		t.Errorf("Decode = %+v, want the first file hook", hook)
+	}
+}
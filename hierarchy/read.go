@@ -0,0 +1,204 @@
+package hierarchy
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// The methods below shadow the ones of the embedded viper so that every read
+// goes through the layers of the hierarchy and resolves references.
+
+// Get returns the value associated with the key, with references resolved.
+func (h *Hierarchy) Get(key string) interface{} {
+	if h.root != nil {
+		return h.root.Get(h.absolute(key))
+	}
+
+	l := h.current.Load()
+	r := newResolver(l.tree)
+	path := splitKey(l.realKey(key))
+	raw, _ := lookupPath(r.tree, path)
+
+	return h.cased(l, strings.Join(path, "."), r.value(raw))
+}
+
+// AllSettings returns a map of all settings, with references resolved.
+func (h *Hierarchy) AllSettings() map[string]interface{} {
+	if h.root != nil {
+		return cast.ToStringMap(h.root.Get(h.prefix))
+	}
+
+	l := h.current.Load()
+
+	return cast.ToStringMap(h.cased(l, "", h.settings(l)))
+}
+
+// InConfig reports whether key is set by a config asset or file, rather than by defaults,
+// env vars, flags or Set.
+func (h *Hierarchy) InConfig(key string) bool {
+	if h.root != nil {
+		return h.root.InConfig(h.absolute(key))
+	}
+
+	l := h.current.Load()
+	value, ok := lookupPath(l.config, splitKey(l.realKey(key)))
+
+	return ok && value != nil && !isTombstone(value)
+}
+
+// settings returns the resolved settings of l, with lowercased keys.
+func (h *Hierarchy) settings(l *layers) map[string]interface{} {
+	r := newResolver(l.tree)
+
+	return cast.ToStringMap(r.value(r.tree))
+}
+
+// Unmarshal unmarshals the resolved config into a struct, then checks its `validate` tags.
+func (h *Hierarchy) Unmarshal(rawVal interface{}, opts ...viper.DecoderConfigOption) error {
+	if err := unmarshal(h.AllSettings(), rawVal, opts...); err != nil {
+		return err
+	}
+
+	return h.checkConstraints("", rawVal)
+}
+
+// UnmarshalExact is like Unmarshal, but fails on keys that rawVal has no field for.
+func (h *Hierarchy) UnmarshalExact(rawVal interface{}, opts ...viper.DecoderConfigOption) error {
+	opts = append(opts, func(config *mapstructure.DecoderConfig) {
+		config.ErrorUnused = true
+	})
+
+	return h.Unmarshal(rawVal, opts...)
+}
+
+// UnmarshalKey unmarshals a single resolved key, which may address an array item, into a struct,
+// then checks its `validate` tags.
+func (h *Hierarchy) UnmarshalKey(key string, rawVal interface{}, opts ...viper.DecoderConfigOption) error {
+	if err := unmarshal(h.Get(key), rawVal, opts...); err != nil {
+		return err
+	}
+
+	return h.checkConstraints(strings.Join(splitKey(key), "."), rawVal)
+}
+
+// unmarshal decodes input like viper does, without lowercasing the keys of maps on the way.
+func unmarshal(input, output interface{}, opts ...viper.DecoderConfigOption) error {
+	config := &mapstructure.DecoderConfig{
+		Result:           output,
+		WeaklyTypedInput: true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+	}
+
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	decoder, err := mapstructure.NewDecoder(config)
+	if err != nil {
+		return err
+	}
+
+	return decoder.Decode(input)
+}
+
+// GetString returns the value associated with the key as a string.
+func (h *Hierarchy) GetString(key string) string {
+	return cast.ToString(h.Get(key))
+}
+
+// GetBool returns the value associated with the key as a boolean.
+func (h *Hierarchy) GetBool(key string) bool {
+	return cast.ToBool(h.Get(key))
+}
+
+// GetInt returns the value associated with the key as an integer.
+func (h *Hierarchy) GetInt(key string) int {
+	return cast.ToInt(h.Get(key))
+}
+
+// GetInt32 returns the value associated with the key as an integer.
+func (h *Hierarchy) GetInt32(key string) int32 {
+	return cast.ToInt32(h.Get(key))
+}
+
+// GetInt64 returns the value associated with the key as an integer.
+func (h *Hierarchy) GetInt64(key string) int64 {
+	return cast.ToInt64(h.Get(key))
+}
+
+// GetUint returns the value associated with the key as an unsigned integer.
+func (h *Hierarchy) GetUint(key string) uint {
+	return cast.ToUint(h.Get(key))
+}
+
+// GetUint16 returns the value associated with the key as an unsigned integer.
+func (h *Hierarchy) GetUint16(key string) uint16 {
+	return cast.ToUint16(h.Get(key))
+}
+
+// GetUint32 returns the value associated with the key as an unsigned integer.
+func (h *Hierarchy) GetUint32(key string) uint32 {
+	return cast.ToUint32(h.Get(key))
+}
+
+// GetUint64 returns the value associated with the key as an unsigned integer.
+func (h *Hierarchy) GetUint64(key string) uint64 {
+	return cast.ToUint64(h.Get(key))
+}
+
+// GetFloat64 returns the value associated with the key as a float64.
+func (h *Hierarchy) GetFloat64(key string) float64 {
+	return cast.ToFloat64(h.Get(key))
+}
+
+// GetTime returns the value associated with the key as time.
+func (h *Hierarchy) GetTime(key string) time.Time {
+	return cast.ToTime(h.Get(key))
+}
+
+// GetDuration returns the value associated with the key as a duration.
+func (h *Hierarchy) GetDuration(key string) time.Duration {
+	return cast.ToDuration(h.Get(key))
+}
+
+// GetIntSlice returns the value associated with the key as a slice of integers.
+func (h *Hierarchy) GetIntSlice(key string) []int {
+	return cast.ToIntSlice(h.Get(key))
+}
+
+// GetStringSlice returns the value associated with the key as a slice of strings.
+func (h *Hierarchy) GetStringSlice(key string) []string {
+	return cast.ToStringSlice(h.Get(key))
+}
+
+// GetStringMap returns the value associated with the key as a map of interfaces.
+func (h *Hierarchy) GetStringMap(key string) map[string]interface{} {
+	return cast.ToStringMap(h.Get(key))
+}
+
+// GetStringMapString returns the value associated with the key as a map of strings.
+func (h *Hierarchy) GetStringMapString(key string) map[string]string {
+	return cast.ToStringMapString(h.Get(key))
+}
+
+// GetStringMapStringSlice returns the value associated with the key as a map to a slice of strings.
+func (h *Hierarchy) GetStringMapStringSlice(key string) map[string][]string {
+	return cast.ToStringMapStringSlice(h.Get(key))
+}
+
+// GetSizeInBytes returns the size in bytes for the given key.
+func (h *Hierarchy) GetSizeInBytes(key string) uint {
+	size, err := ParseByteSize(cast.ToString(h.Get(key)))
+	if err != nil {
+		return 0
+	}
+
+	return uint(size)
+}
@@ -0,0 +1,331 @@
+package hierarchy
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// DefaultSensitiveKeys are the patterns of the keys whose values are redacted, unless
+// SensitiveKeys replaces them.
+var DefaultSensitiveKeys = []string{
+	"*token*", "*password*", "*passwd*", "*secret*", "*credential*", "*api_key*", "*apikey*", "*private_key*",
+}
+
+// SensitiveKeys replaces DefaultSensitiveKeys with patterns, see MarkSensitive.
+func SensitiveKeys(patterns ...string) Option {
+	return func(h *Hierarchy) {
+		h.sensitiveKeys = append([]string{}, patterns...)
+	}
+}
+
+func MarkSensitive(patterns ...string) {
+	_default.MarkSensitive(patterns...)
+}
+
+// MarkSensitive redacts the values of the keys matching patterns, and every value under
+// them. A pattern without dots matches any segment of a key, e.g. `*token*` matches
+// `logger.hooks.0.token`; a dotted pattern matches from the root with `*` matching one
+// segment, e.g. `database.*.dsn`. Keys are matched case-insensitively.
+//
+// Keys described as `writeOnly` or with the `password` format by a registered schema, keys
+// whose values were decrypted from assets, and keys holding ${secret:...} references or
+// references to sensitive keys are sensitive too.
+func (h *Hierarchy) MarkSensitive(patterns ...string) {
+	if h.root != nil {
+		absolute := make([]string, 0, len(patterns))
+
+		for _, pattern := range patterns {
+			if strings.Contains(pattern, ".") {
+				pattern = h.absolute(pattern)
+			}
+
+			absolute = append(absolute, pattern)
+		}
+
+		h.root.MarkSensitive(absolute...)
+
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.sensitiveKeys == nil {
+		h.sensitiveKeys = append([]string{}, DefaultSensitiveKeys...)
+	}
+
+	h.sensitiveKeys = append(h.sensitiveKeys, patterns...)
+}
+
+func IsSensitive(key string) bool {
+	return _default.IsSensitive(key)
+}
+
+// IsSensitive reports whether the value of key is redacted, see MarkSensitive.
+func (h *Hierarchy) IsSensitive(key string) bool {
+	return h.base().sensitivity().matches(splitKey(h.absolute(key)))
+}
+
+func Redacted() map[string]interface{} {
+	return _default.Redacted()
+}
+
+// Redacted returns AllSettings with the values of sensitive keys masked, see MarkSensitive.
+// String, JSON, JSONIndent, Diff and Explain redact their values likewise; Export does not.
+func (h *Hierarchy) Redacted() map[string]interface{} {
+	settings := h.AllSettings()
+	s := h.base().sensitivity()
+
+	redacted, _ := s.redact(splitKey(h.prefix), settings).(map[string]interface{})
+
+	return redacted
+}
+
+// sensitivity matches sensitive keys.
+type sensitivity struct {
+	// segments are patterns matching any segment of a key.
+	segments []string
+	// paths are patterns matching keys from the root, split into segments.
+	paths [][]string
+}
+
+// sensitivity collects the sensitive keys of h, which is not a view.
+func (h *Hierarchy) sensitivity() *sensitivity {
+	s := &sensitivity{}
+
+	h.mu.Lock()
+	patterns := h.sensitiveKeys
+
+	if patterns == nil {
+		patterns = DefaultSensitiveKeys
+	}
+
+	for key, schema := range h.schemas {
+		s.addSchema(splitKey(key), schema.schema, make(map[*jsonschema.Schema]bool))
+	}
+	h.mu.Unlock()
+
+	for _, pattern := range patterns {
+		s.add(pattern)
+	}
+
+	l := h.current.Load()
+
+	for path := range l.sensitive {
+		s.paths = append(s.paths, strings.Split(path, "."))
+	}
+
+	s.addReferences(l.tree)
+
+	return s
+}
+
+// add adds a pattern of MarkSensitive.
+func (s *sensitivity) add(pattern string) {
+	pattern = strings.ToLower(pattern)
+
+	if strings.Contains(pattern, ".") {
+		s.paths = append(s.paths, strings.Split(pattern, "."))
+	} else {
+		s.segments = append(s.segments, pattern)
+	}
+}
+
+// addSchema adds the keys described as writeOnly or with the password format by schema.
+func (s *sensitivity) addSchema(prefix []string, schema *jsonschema.Schema, seen map[*jsonschema.Schema]bool) {
+	if schema == nil || seen[schema] {
+		return
+	}
+
+	seen[schema] = true
+
+	if schema.WriteOnly || schema.Format == "password" {
+		s.paths = append(s.paths, prefix)
+
+		return
+	}
+
+	s.addSchema(prefix, schema.Ref, seen)
+
+	for _, sub := range append(append(schema.AllOf, schema.AnyOf...), schema.OneOf...) {
+		s.addSchema(prefix, sub, seen)
+	}
+
+	for name, property := range schema.Properties {
+		s.addSchema(append(prefix[:len(prefix):len(prefix)], strings.ToLower(name)), property, seen)
+	}
+
+	items := schema.Items2020
+	if items == nil {
+		items, _ = schema.Items.(*jsonschema.Schema)
+	}
+
+	s.addSchema(append(prefix[:len(prefix):len(prefix)], "*"), items, seen)
+
+	if additional, ok := schema.AdditionalProperties.(*jsonschema.Schema); ok {
+		s.addSchema(append(prefix[:len(prefix):len(prefix)], "*"), additional, seen)
+	}
+}
+
+// addReferences adds the keys holding ${secret:...} references in the raw tree, and the
+// keys holding references to sensitive keys, which copy their values.
+func (s *sensitivity) addReferences(tree map[string]interface{}) {
+	references := make(map[string]*Reference)
+	collectReferences(nil, tree, references)
+
+	// A reference may copy a key made sensitive by another reference, so this runs until
+	// no key is added; references in a cycle resolve to nothing.
+	for added := true; added; {
+		added = false
+
+		for key, ref := range references {
+			if s.reveals(ref.segments) {
+				s.paths = append(s.paths, strings.Split(key, "."))
+				delete(references, key)
+
+				added = true
+			}
+		}
+	}
+}
+
+// collectReferences collects the references under value, at prefix, by lowercased path.
+func collectReferences(prefix []string, value interface{}, references map[string]*Reference) {
+	switch v := value.(type) {
+	case *Reference:
+		references[strings.Join(prefix, ".")] = v
+	case map[string]interface{}:
+		for key, child := range v {
+			collectReferences(append(prefix[:len(prefix):len(prefix)], strings.ToLower(key)), child, references)
+		}
+	case []interface{}:
+		for index, child := range v {
+			collectReferences(append(prefix[:len(prefix):len(prefix)], strconv.Itoa(index)), child, references)
+		}
+	}
+}
+
+// reveals reports whether segments resolve a secret, or a key that is sensitive or has
+// sensitive keys under it.
+func (s *sensitivity) reveals(segments []segment) bool {
+	for _, seg := range segments {
+		if seg.ref == nil {
+			continue
+		}
+
+		switch {
+		case seg.ref.namespace == "secret", s.reveals(seg.ref.arg):
+			return true
+		case seg.ref.namespace == "" && s.covers(splitKey(seg.ref.key)):
+			return true
+		}
+	}
+
+	return false
+}
+
+// covers reports whether the key split into keyPath, or a key under it, is sensitive.
+// Keys under it matching segment patterns are redacted wherever they are copied.
+func (s *sensitivity) covers(keyPath []string) bool {
+	if s.matches(keyPath) {
+		return true
+	}
+
+	for _, pattern := range s.paths {
+		if len(pattern) > len(keyPath) && matchSegments(pattern[:len(keyPath)], keyPath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matches reports whether the key split into path, or a parent of it, is sensitive.
+func (s *sensitivity) matches(keyPath []string) bool {
+	for index, segment := range keyPath {
+		segment = strings.ToLower(segment)
+
+		for _, pattern := range s.segments {
+			if ok, _ := path.Match(pattern, segment); ok {
+				return true
+			}
+		}
+
+		for _, pattern := range s.paths {
+			if len(pattern) == index+1 && matchSegments(pattern, keyPath[:index+1]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func matchSegments(patterns, segments []string) bool {
+	for index, pattern := range patterns {
+		if ok, _ := path.Match(pattern, strings.ToLower(segments[index])); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// redact masks the values of sensitive keys in value, found at keyPath.
+func (s *sensitivity) redact(keyPath []string, value interface{}) interface{} {
+	if len(keyPath) > 0 && s.matches(keyPath) {
+		return maskValue(value)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[key] = s.redact(append(keyPath[:len(keyPath):len(keyPath)], key), child)
+		}
+
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for index, child := range v {
+			items[index] = s.redact(append(keyPath[:len(keyPath):len(keyPath)], strconv.Itoa(index)), child)
+		}
+
+		return items
+	default:
+		return value
+	}
+}
+
+// maskValue masks every leaf of value but nil and empty strings, which tell nothing.
+func maskValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		if v == "" {
+			return v
+		}
+
+		return secretMask
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[key] = maskValue(child)
+		}
+
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for index, child := range v {
+			items[index] = maskValue(child)
+		}
+
+		return items
+	default:
+		return secretMask
+	}
+}
@@ -0,0 +1,102 @@
+package hierarchy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedactByPath(t *testing.T) {
+	RegisterSecretBackend("redact", SecretBackendFunc(func(path string) (string, bool, error) {
+		return "hunter2", path == "db", nil
+	}))
+
+	h := New()
+	if err := h.LoadAssetMap(map[string][]byte{"app.yaml": []byte(`
+database:
+  password: ${secret:redact:db}
+  user: hunter2
+api:
+  token: abcd
+  key: ${api.token}
+copy: ${copied}
+copied: ${database}
+note: hunter2 is the password
+`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key       string
+		sensitive bool
+	}{
+		{key: "database.password", sensitive: true},
+		{key: "database.user"},
+		{key: "api.token", sensitive: true},
+		// References copying sensitive keys, or keys with sensitive keys under them.
+		{key: "api.key", sensitive: true},
+		{key: "copied", sensitive: true},
+		{key: "copy", sensitive: true},
+		{key: "note"},
+	}
+
+	for _, test := range tests {
+		if got := h.IsSensitive(test.key); got != test.sensitive {
+			t.Errorf("IsSensitive(%s) = %v, want %v", test.key, got, test.sensitive)
+		}
+	}
+
+	// Equal values of other keys are left alone, since redaction goes by key.
+	settings := h.Redacted()
+	if got := settings["note"]; got != "hunter2 is the password" {
+		t.Errorf("Redacted note = %v, want it unmasked", got)
+	}
+
+	if got := settings["database"].(map[string]interface{})["user"]; got != "hunter2" {
+		t.Errorf("Redacted database.user = %v, want it unmasked", got)
+	}
+
+	if s := h.Explain("database.password").String(); strings.Contains(s, "hunter2") {
+		t.Errorf("Explain(database.password) = %s, want it redacted", s)
+	}
+
+	other := New()
+	other.Set("api.token", "efgh")
+
+	if text := Diff(h, other).Text(); strings.Contains(text, "abcd") || strings.Contains(text, "efgh") {
+		t.Errorf("Diff = %s, want api.token redacted", text)
+	}
+}
+
+func TestRedactEnvVars(t *testing.T) {
+	t.Setenv("REDACTTEST_DB_PASSWORD", "hunter2")
+	t.Setenv("REDACTTEST_API", `{"user": "api", "token": "abcd"}`)
+	t.Setenv("REDACTTEST_LEVEL", "debug")
+
+	h := New()
+	if err := h.LoadEnv("REDACTTEST"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"db.password": secretMask,
+		"api":         map[string]interface{}{"user": "api", "token": secretMask},
+		"level":       "debug",
+	}
+
+	envVars := h.EnvVars()
+	if len(envVars) != len(want) {
+		t.Fatalf("EnvVars() = %+v, want %d env vars", envVars, len(want))
+	}
+
+	for _, envVar := range envVars {
+		if !reflect.DeepEqual(envVar.Value, want[envVar.Key]) {
+			t.Errorf("EnvVars() %s = %#v, want %#v", envVar.Name, envVar.Value, want[envVar.Key])
+		}
+	}
+
+	// The env vars still apply their values.
+	if got := h.GetString("db.password"); got != "hunter2" {
+		t.Errorf("db.password = %q, want the env var", got)
+	}
+}
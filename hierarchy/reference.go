@@ -0,0 +1,246 @@
+package hierarchy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+var ErrReferenceCycle = errors.New("reference cycle")
+
+// Reference is a value holding ${...} references.
+// It is kept unresolved in the hierarchy and resolved each time it is read,
+// so it always sees the latest files, environment variables, flags and Set calls.
+// A value that is a single reference to a key, e.g. `${server.port}`, keeps the type
+// of the value of the key.
+type Reference struct {
+	raw      string
+	segments []segment
+}
+
+// NewReference parses s into a reference, e.g. NewReference("${ProjectDir}/log").
+func NewReference(s string) *Reference {
+	return &Reference{raw: s, segments: parseTemplate(s)}
+}
+
+func (r *Reference) String() string {
+	return r.raw
+}
+
+func (r *Reference) MarshalText() ([]byte, error) {
+	return []byte(r.raw), nil
+}
+
+// parseReferences replaces every string holding a reference with a *Reference.
+// Strings holding only escaped $${...} are unescaped.
+func parseReferences(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if !strings.Contains(v, "${") {
+			return v
+		}
+
+		segments := parseTemplate(v)
+		for _, seg := range segments {
+			if seg.ref != nil {
+				return &Reference{raw: v, segments: segments}
+			}
+		}
+
+		return expand(segments, nil, nil, nil)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[key] = parseReferences(child)
+		}
+
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for index, child := range v {
+			items[index] = parseReferences(child)
+		}
+
+		return items
+	default:
+		return value
+	}
+}
+
+// resolver resolves references against the tree of a hierarchy, tracking the keys being
+// resolved to detect cycles. Using a single tree keeps the result consistent during writes.
+type resolver struct {
+	tree       map[string]interface{}
+	namespaces namespaceFunc
+	errs       *InterpolationError
+	stack      []string
+	// opaque is set when the reference being expanded depends on a namespaced reference
+	// that a checking resolver did not resolve.
+	opaque bool
+}
+
+func newResolver(tree map[string]interface{}) *resolver {
+	return &resolver{tree: tree, namespaces: lookupResolver, errs: &InterpolationError{}}
+}
+
+// newCheckingResolver returns a resolver that does not run namespaced resolvers, which may
+// call secret backends, so that writes can check references under the write lock. Values
+// depending on them resolve to unchecked.
+func newCheckingResolver(tree map[string]interface{}) *resolver {
+	r := newResolver(tree)
+	r.namespaces = r.checkNamespace
+
+	return r
+}
+
+// unchecked stands for the values a checking resolver cannot know.
+type unchecked struct{}
+
+// checkNamespace only reports unknown namespaces, see newCheckingResolver.
+func (r *resolver) checkNamespace(name string) (ResolverFunc, bool) {
+	if _, ok := lookupResolver(name); !ok {
+		return nil, false
+	}
+
+	return func(string) (string, bool, error) {
+		r.opaque = true
+
+		return "", true, nil
+	}, true
+}
+
+func (r *resolver) value(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *Reference:
+		// A value that is a single reference to a key keeps the type of its value.
+		if len(v.segments) == 1 && v.segments[0].ref.namespace == "" {
+			if resolved, ok := r.resolve(v.segments[0].ref.key); ok {
+				return resolved
+			}
+		}
+
+		opaque := r.opaque
+		r.opaque = false
+
+		s := expand(v.segments, r.lookup, r.namespaces, r.errs)
+		if r.opaque {
+			r.opaque = opaque
+
+			return unchecked{}
+		}
+
+		r.opaque = opaque
+
+		return s
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[key] = r.value(child)
+		}
+
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for index, child := range v {
+			items[index] = r.value(child)
+		}
+
+		return items
+	default:
+		return value
+	}
+}
+
+func (r *resolver) lookup(key string) (string, bool, error) {
+	lcaseKey := strings.ToLower(key)
+
+	for _, k := range r.stack {
+		if k == lcaseKey {
+			return "", true, fmt.Errorf("%w: %s -> %s", ErrReferenceCycle, strings.Join(r.stack, " -> "), lcaseKey)
+		}
+	}
+
+	value, ok := r.resolve(key)
+	if !ok {
+		return "", false, nil
+	}
+
+	if _, ok := value.(unchecked); ok {
+		r.opaque = true
+
+		return "", true, nil
+	}
+
+	s, err := cast.ToStringE(value)
+	if err != nil {
+		return "", true, err
+	}
+
+	return s, true, nil
+}
+
+// resolve returns the resolved value of key, false if it is not set or is being resolved,
+// in which case lookup reports the cycle.
+func (r *resolver) resolve(key string) (interface{}, bool) {
+	lcaseKey := strings.ToLower(key)
+
+	for _, k := range r.stack {
+		if k == lcaseKey {
+			return nil, false
+		}
+	}
+
+	raw, ok := lookupPath(r.tree, splitKey(key))
+	if !ok || raw == nil {
+		return nil, false
+	}
+
+	r.stack = append(r.stack, lcaseKey)
+	value := r.value(raw)
+	r.stack = r.stack[:len(r.stack)-1]
+
+	return value, true
+}
+
+func Resolve() error {
+	return _default.Resolve()
+}
+
+// Resolve resolves every reference in the hierarchy and reports all that fail,
+// including cycles. It is meant as a final check once every source is loaded.
+func (h *Hierarchy) Resolve() error {
+	r := newResolver(h.base().tree())
+	subtree, _ := lookupPath(r.tree, splitKey(h.prefix))
+	r.value(subtree)
+
+	if r.errs.empty() {
+		return nil
+	}
+
+	return r.errs
+}
+
+// checkReferences resolves every reference of l and returns the errors no later source can
+// fix: unknown namespaces and cycles. References to keys that are not set, even required
+// ones, are left to Resolve, as a later source may set them. Namespaced references are not
+// resolved, see newCheckingResolver, so a failing secret backend does not fail writes.
+func (h *Hierarchy) checkReferences(l *layers) error {
+	r := newCheckingResolver(l.tree)
+	r.value(r.tree)
+
+	errs := &InterpolationError{}
+
+	for _, err := range r.errs.Errors {
+		if !errors.Is(err, ErrReferenceRequired) {
+			errs.Errors = append(errs.Errors, err)
+		}
+	}
+
+	if errs.empty() {
+		return nil
+	}
+
+	return errs
+}
@@ -0,0 +1,110 @@
+package hierarchy
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReferences(t *testing.T) {
+	h := New()
+	if err := h.LoadAssetMap(map[string][]byte{"app.yaml": []byte(`
+server:
+  port: 8080
+  tls: {enabled: true}
+  hosts: [a, b]
+port: ${server.port}
+tls: ${server.tls}
+hosts: ${server.hosts}
+url: http://localhost:${server.port}/${path:-api}
+later: ${late.value}
+`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key  string
+		want interface{}
+	}{
+		{key: "port", want: 8080},
+		{key: "tls", want: map[string]interface{}{"enabled": true}},
+		{key: "hosts", want: []interface{}{"a", "b"}},
+		{key: "url", want: "http://localhost:8080/api"},
+		{key: "later", want: ""},
+	}
+
+	for _, test := range tests {
+		if got := h.Get(test.key); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Get(%s) = %#v, want %#v", test.key, got, test.want)
+		}
+	}
+
+	if err := h.Resolve(); !errors.Is(err, ErrUnresolvedReference) {
+		t.Errorf("Resolve() = %v, want ErrUnresolvedReference", err)
+	}
+
+	h.Set("late.value", 1)
+
+	if got := h.Get("later"); got != 1 {
+		t.Errorf("Get(later) after Set = %#v, want 1", got)
+	}
+
+	if err := h.Resolve(); err != nil {
+		t.Errorf("Resolve() = %v", err)
+	}
+}
+
+func TestReferenceErrors(t *testing.T) {
+	failing := errors.New("backend down")
+	RegisterResolver("failing", func(string) (string, bool, error) {
+		return "", false, failing
+	})
+
+	tests := []struct {
+		name  string
+		asset string
+		want  error
+	}{
+		{name: "cycle", asset: "a: ${b}\nb: ${a}\n", want: ErrReferenceCycle},
+		{name: "namespace", asset: "token: ${missing:token}\n", want: ErrUnresolvedReference},
+	}
+
+	for _, test := range tests {
+		h := New()
+		h.Set("kept", true)
+
+		err := h.LoadAssetMap(map[string][]byte{"app.yaml": []byte(test.asset)})
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: LoadAssetMap error = %v, want %v", test.name, err, test.want)
+		}
+
+		if keys := h.AllKeys(); !reflect.DeepEqual(keys, []string{"kept"}) {
+			t.Errorf("%s: failed load merged %v", test.name, keys)
+		}
+	}
+
+	// Failing resolvers are left to Resolve too, see TestWritesSkipSecrets.
+	h := New()
+	if err := h.LoadAssetMap(map[string][]byte{"app.yaml": []byte("token: ${failing:token}\n")}); err != nil {
+		t.Errorf("LoadAssetMap with a failing resolver error = %v, want it left to Resolve", err)
+	}
+
+	if err := h.Resolve(); !errors.Is(err, failing) {
+		t.Errorf("Resolve() = %v, want %v", err, failing)
+	}
+
+	h = New()
+	if err := h.LoadAssetMap(map[string][]byte{"app.yaml": []byte("name: ${app.name:?is required}\n")}); err != nil {
+		t.Errorf("LoadAssetMap with a required reference error = %v, want it left to Resolve", err)
+	}
+
+	if err := h.Resolve(); !errors.Is(err, ErrReferenceRequired) {
+		t.Errorf("Resolve() = %v, want ErrReferenceRequired", err)
+	}
+
+	h.Set("a", NewReference("${b}"))
+
+	if err := h.SetE("b", NewReference("${a}")); !errors.Is(err, ErrReferenceCycle) {
+		t.Errorf("SetE closing a cycle error = %v, want ErrReferenceCycle", err)
+	}
+}
@@ -0,0 +1,339 @@
+package hierarchy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudlibraries/libra/assets"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidSchema    = errors.New("invalid schema")
+	ErrValidationFailed = errors.New("validation failed")
+)
+
+// schemaScheme prefixes the URL of schemas, so that relative $ref resolve to other assets.
+const schemaScheme = "libra:///"
+
+// Schema is a compiled JSON Schema, draft 2020-12 unless it declares another with $schema.
+type Schema struct {
+	schema *jsonschema.Schema
+}
+
+// CompileSchema compiles the JSON or YAML schema data; name tells the format by its
+// extension and resolves relative $ref, which must be in the same document.
+func CompileSchema(name string, data []byte) (*Schema, error) {
+	return compileSchema(name, func(string) ([]byte, error) {
+		return data, nil
+	})
+}
+
+// LoadSchema compiles the schema asset name of a. Its relative $ref are loaded from a too.
+func LoadSchema(a *assets.Assets, name string) (*Schema, error) {
+	return compileSchema(name, a.GetAsset)
+}
+
+func compileSchema(name string, read func(name string) ([]byte, error)) (*Schema, error) {
+	c := jsonschema.NewCompiler()
+	c.Draft = jsonschema.Draft2020
+	// Defaults and descriptions are read by AddSchemaFlags.
+	c.ExtractAnnotations = true
+	c.LoadURL = func(url string) (io.ReadCloser, error) {
+		if !strings.HasPrefix(url, schemaScheme) {
+			return jsonschema.LoadURL(url)
+		}
+
+		asset := strings.TrimPrefix(url, schemaScheme)
+
+		data, err := read(asset)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err = schemaJSON(asset, data)
+		if err != nil {
+			return nil, err
+		}
+
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	schema, err := c.Compile(schemaScheme + strings.TrimPrefix(path.Clean("/"+name), "/"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidSchema, name, err)
+	}
+
+	return &Schema{schema: schema}, nil
+}
+
+// schemaJSON converts a YAML schema to JSON.
+func schemaJSON(name string, data []byte) ([]byte, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".yaml", ".yml":
+		var value interface{}
+		if err := yaml.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(value)
+	default:
+		return data, nil
+	}
+}
+
+// Violation is a value failing a schema.
+type Violation struct {
+	// Key is the path of the value, e.g. `logger.hooks.0.format`.
+	Key     string
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Key == "" {
+		return v.Message
+	}
+
+	return fmt.Sprintf("%s: %s", v.Key, v.Message)
+}
+
+// ValidationError lists every violation found by Validate.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.String())
+	}
+
+	return fmt.Sprintf("%v: %s", ErrValidationFailed, strings.Join(messages, "; "))
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidationFailed
+}
+
+func Validate(schema *Schema) error {
+	return _default.Validate(schema)
+}
+
+// Validate validates the resolved settings against schema, returning a *ValidationError
+// with every violation.
+func (h *Hierarchy) Validate(schema *Schema) error {
+	violations, err := validate(schema, "", h.AllSettings())
+	if err != nil {
+		return err
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+
+	return nil
+}
+
+func RegisterSchema(key string, schema *Schema) {
+	_default.RegisterSchema(key, schema)
+}
+
+// RegisterSchema registers schema for the subtree at key, or the whole hierarchy if key is
+// empty. Every later write is validated against registered schemas, and changes nothing
+// if it fails: LoadAssetMap and ReadInConfig fail on any violation, while Set, LoadEnv and
+// the other writes only fail on violations at keys that had none.
+func (h *Hierarchy) RegisterSchema(key string, schema *Schema) {
+	if h.root != nil {
+		h.root.RegisterSchema(h.absolute(key), schema)
+
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.schemas[strings.Join(splitKey(key), ".")] = schema
+}
+
+// checkSchemas validates next against the registered schemas. Loads, which are strict,
+// fail on any violation; other writes only on violations at keys that had none, so that
+// keys can be set one at a time while a subtree is built. h.mu must be held.
+func (h *Hierarchy) checkSchemas(previous, next *layers, strict bool) error {
+	if len(h.schemas) == 0 {
+		return nil
+	}
+
+	after, err := h.registeredViolations(next)
+	if err != nil || len(after) == 0 {
+		return err
+	}
+
+	if !strict {
+		before, err := h.registeredViolations(previous)
+		if err != nil {
+			return err
+		}
+
+		// Messages change as a subtree is built, e.g. missing properties, so violations
+		// are told apart by key.
+		known := make(map[string]bool, len(before))
+		for _, v := range before {
+			known[v.Key] = true
+		}
+
+		introduced := make([]Violation, 0)
+
+		for _, v := range after {
+			if !known[v.Key] {
+				introduced = append(introduced, v)
+			}
+		}
+
+		after = introduced
+	}
+
+	if len(after) > 0 {
+		return &ValidationError{Violations: after}
+	}
+
+	return nil
+}
+
+// registeredViolations validates the settings of l against the registered schemas. It runs
+// under the write lock, so values from namespaced references are not resolved nor checked,
+// see newCheckingResolver.
+func (h *Hierarchy) registeredViolations(l *layers) ([]Violation, error) {
+	r := newCheckingResolver(l.tree)
+	settings := cast.ToStringMap(r.value(r.tree))
+
+	var skipped []string
+
+	collectUnchecked(settings, "", &skipped)
+
+	keys := make([]string, 0, len(h.schemas))
+
+	for key := range h.schemas {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	found := make([]Violation, 0)
+
+	for _, key := range keys {
+		value, ok := lookupPath(settings, splitKey(key))
+		if !ok {
+			value = nil
+		}
+
+		violations, err := validate(h.schemas[key], key, value)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range violations {
+			if !underAny(v.Key, skipped) {
+				found = append(found, v)
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// collectUnchecked replaces the unchecked values of value with nil, adding their paths to paths.
+func collectUnchecked(value interface{}, path string, paths *[]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if _, ok := child.(unchecked); ok {
+				v[key] = nil
+				*paths = append(*paths, joinPath(path, key))
+			} else {
+				collectUnchecked(child, joinPath(path, key), paths)
+			}
+		}
+	case []interface{}:
+		for index, child := range v {
+			if _, ok := child.(unchecked); ok {
+				v[index] = nil
+				*paths = append(*paths, joinPath(path, strconv.Itoa(index)))
+			} else {
+				collectUnchecked(child, joinPath(path, strconv.Itoa(index)), paths)
+			}
+		}
+	}
+}
+
+// underAny reports whether key is one of paths or under one of them.
+func underAny(key string, paths []string) bool {
+	for _, path := range paths {
+		if key == path || strings.HasPrefix(key, path+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validate validates value, found at key, against schema.
+func validate(schema *Schema, key string, value interface{}) ([]Violation, error) {
+	// The schema validates JSON values, so numbers and other types are converted through JSON.
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var instance interface{}
+	if err := decoder.Decode(&instance); err != nil {
+		return nil, err
+	}
+
+	var validationErr *jsonschema.ValidationError
+
+	err = schema.schema.Validate(instance)
+	if err == nil {
+		return nil, nil
+	} else if !errors.As(err, &validationErr) {
+		return nil, err
+	}
+
+	return violations(key, validationErr, nil), nil
+}
+
+// violations flattens the leaves of the tree of validation errors.
+func violations(key string, err *jsonschema.ValidationError, found []Violation) []Violation {
+	if len(err.Causes) == 0 {
+		return append(found, Violation{Key: pointerKey(key, err.InstanceLocation), Message: err.Message})
+	}
+
+	for _, cause := range err.Causes {
+		found = violations(key, cause, found)
+	}
+
+	return found
+}
+
+// pointerKey converts a JSON pointer relative to key into a dotted key.
+func pointerKey(key, pointer string) string {
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if token != "" {
+			token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+			key = joinPath(key, token)
+		}
+	}
+
+	return key
+}
@@ -0,0 +1,72 @@
+package hierarchy
+
+import (
+	"errors"
+	"testing"
+)
+
+const serverSchema = `
+type: object
+required: [name, port]
+properties:
+  name: {type: string}
+  port: {type: integer, minimum: 1}
+  level: {enum: [debug, info, warn, error]}
+`
+
+func TestRegisterSchema(t *testing.T) {
+	schema, err := CompileSchema("server.yaml", []byte(serverSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := New()
+	h.RegisterSchema("server", schema)
+
+	err = h.LoadAssetMap(map[string][]byte{"app.yaml": []byte("server: {name: api}\n")})
+	if !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("LoadAssetMap missing server.port error = %v, want ErrValidationFailed", err)
+	}
+
+	if h.IsSet("server.name") {
+		t.Error("a load failing validation merged its settings")
+	}
+
+	// Keys may be set one at a time, while the required ones are still missing.
+	if err := h.SetE("server.name", "api"); err != nil {
+		t.Errorf("SetE(server.name) error = %v", err)
+	}
+
+	if err := h.SetE("server.port", 8080); err != nil {
+		t.Errorf("SetE(server.port) error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		write func() error
+	}{
+		{name: "wrong type", write: func() error { return h.SetE("server.port", "http") }},
+		{name: "out of enum", write: func() error { return h.SetE("server.level", "verbose") }},
+		{name: "required deleted", write: func() error { return h.DeleteE("server.name") }},
+		{name: "default", write: func() error { return h.SetDefaultE("server.level", "trace") }},
+	}
+
+	for _, test := range tests {
+		var validationErr *ValidationError
+		if err := test.write(); !errors.As(err, &validationErr) || len(validationErr.Violations) != 1 {
+			t.Errorf("%s: error = %v, want one violation", test.name, err)
+		}
+	}
+
+	if got := h.GetInt("server.port"); got != 8080 {
+		t.Errorf("server.port = %d after failed writes, want 8080", got)
+	}
+
+	if err := h.Validate(schema); err == nil {
+		t.Error("Validate(whole hierarchy) passed, want the schema of server to fail at the root")
+	}
+
+	if err := h.Sub("server").Validate(schema); err != nil {
+		t.Errorf("Validate(server) = %v", err)
+	}
+}
@@ -0,0 +1,340 @@
+package hierarchy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrInvalidSecret   = errors.New("invalid secret")
+	ErrInsecureKeyring = errors.New("keyring file is readable by others")
+)
+
+const (
+	// secretMask replaces secret values in printed output.
+	secretMask = "******"
+	// DefaultSecretTTL is how long resolved secrets are cached, so that rotated ones are
+	// picked up without hitting backends on every read.
+	DefaultSecretTTL = 5 * time.Minute
+)
+
+// SecretBackend looks up secrets by path, e.g. `telegram/token`. It returns false when the
+// secret does not exist, so that the next backend is tried.
+type SecretBackend interface {
+	Secret(path string) (string, bool, error)
+}
+
+// SecretBackendFunc adapts a function to SecretBackend.
+type SecretBackendFunc func(path string) (string, bool, error)
+
+func (f SecretBackendFunc) Secret(path string) (string, bool, error) {
+	return f(path)
+}
+
+type namedBackend struct {
+	name    string
+	backend SecretBackend
+}
+
+type cachedSecret struct {
+	value   string
+	ok      bool
+	expires time.Time
+}
+
+// secretStore resolves ${secret:path} references through its backends, in order.
+type secretStore struct {
+	mu       sync.Mutex
+	backends []namedBackend
+	ttl      time.Duration
+	cache    map[string]cachedSecret
+	// generation counts the cache resets, so that a lookup started before one does not
+	// fill the cache with a value of the previous backends.
+	generation int
+}
+
+var secrets = &secretStore{
+	backends: []namedBackend{
+		{name: "env", backend: EnvSecrets("")},
+		{name: "file", backend: DirSecrets("/run/secrets")},
+	},
+	ttl:   DefaultSecretTTL,
+	cache: make(map[string]cachedSecret),
+}
+
+// RegisterSecretBackend adds backend to the backends resolving ${secret:path} references,
+// after the others, or replaces the backend registered as name. The `env` and `file`
+// backends, reading EnvSecrets("") and DirSecrets("/run/secrets"), are registered by
+// default. `${secret:name:path}` resolves path through the backend name only.
+func RegisterSecretBackend(name string, backend SecretBackend) {
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+
+	secrets.cache = make(map[string]cachedSecret)
+	secrets.generation++
+
+	for index, b := range secrets.backends {
+		if b.name == name {
+			secrets.backends[index].backend = backend
+
+			return
+		}
+	}
+
+	secrets.backends = append(secrets.backends, namedBackend{name: name, backend: backend})
+}
+
+// SetSecretTTL sets how long resolved secrets are cached, DefaultSecretTTL by default.
+// Zero disables the cache.
+func SetSecretTTL(ttl time.Duration) {
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+
+	secrets.ttl = ttl
+}
+
+// RefreshSecrets drops cached secrets, so that the next reads get rotated values.
+func RefreshSecrets() {
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+
+	secrets.cache = make(map[string]cachedSecret)
+	secrets.generation++
+}
+
+// resolveSecret looks key up in the cache, then in the backends. Backends are called
+// without holding the lock, so that a slow one does not block other lookups; concurrent
+// misses of one key may each call them.
+func resolveSecret(key string) (string, bool, error) {
+	secrets.mu.Lock()
+	cached, ok := secrets.cache[key]
+	backends, ttl, generation := secrets.backends, secrets.ttl, secrets.generation
+	secrets.mu.Unlock()
+
+	if ok && time.Now().Before(cached.expires) {
+		return cached.value, cached.ok, nil
+	}
+
+	secretPath := key
+	if name, rest, ok := strings.Cut(key, ":"); ok {
+		for _, b := range backends {
+			if b.name == name {
+				backends, secretPath = []namedBackend{b}, rest
+			}
+		}
+	}
+
+	value, found := "", false
+
+	for _, b := range backends {
+		var err error
+
+		value, found, err = b.backend.Secret(secretPath)
+		if err != nil {
+			return "", false, fmt.Errorf("secret backend %s: %w", b.name, err)
+		}
+
+		if found {
+			break
+		}
+	}
+
+	secrets.mu.Lock()
+	if ttl > 0 && generation == secrets.generation {
+		secrets.cache[key] = cachedSecret{value: value, ok: found, expires: time.Now().Add(ttl)}
+	}
+	secrets.mu.Unlock()
+
+	return value, found, nil
+}
+
+var envSecretExp = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// EnvSecrets reads secrets from env vars named after their path and prefix,
+// e.g. `APP_TELEGRAM_TOKEN` for `telegram/token` with the prefix `APP`.
+func EnvSecrets(prefix string) SecretBackend {
+	return SecretBackendFunc(func(secretPath string) (string, bool, error) {
+		name := envSecretExp.ReplaceAllString(strings.ToUpper(secretPath), "_")
+		if prefix != "" {
+			name = strings.ToUpper(prefix) + "_" + name
+		}
+
+		value, ok := os.LookupEnv(name)
+
+		return value, ok, nil
+	})
+}
+
+// DirSecrets reads secrets from the files of dir, such as /run/secrets, at their path or,
+// as flat directories are common, with slashes replaced by underscores: `telegram/token`
+// or `telegram_token`. Trailing newlines are trimmed.
+func DirSecrets(dir string) SecretBackend {
+	return SecretBackendFunc(func(secretPath string) (string, bool, error) {
+		clean := path.Clean("/" + secretPath)[1:]
+		if clean == "" || clean != strings.Trim(secretPath, "/") {
+			return "", false, fmt.Errorf("%w: %s", ErrInvalidSecret, secretPath)
+		}
+
+		for _, name := range []string{clean, strings.ReplaceAll(clean, "/", "_")} {
+			data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			if err == nil {
+				return strings.TrimRight(string(data), "\r\n"), true, nil
+			} else if !os.IsNotExist(err) {
+				return "", false, err
+			}
+		}
+
+		return "", false, nil
+	})
+}
+
+// KeyringSecrets reads secrets from a JSON or YAML keyring file only its owner can read,
+// where `telegram/token` is the value at `telegram: {token: ...}` or `telegram/token: ...`.
+// The file is read on each lookup that misses the cache, so that edits are picked up.
+func KeyringSecrets(file string) SecretBackend {
+	return SecretBackendFunc(func(secretPath string) (string, bool, error) {
+		info, err := os.Stat(file)
+		if os.IsNotExist(err) {
+			return "", false, nil
+		} else if err != nil {
+			return "", false, err
+		}
+
+		if info.Mode().Perm()&0o077 != 0 {
+			return "", false, fmt.Errorf("%w: %s", ErrInsecureKeyring, file)
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, err
+		}
+
+		var keyring map[string]interface{}
+		if err := yaml.Unmarshal(data, &keyring); err != nil {
+			return "", false, fmt.Errorf("%s: %w", file, err)
+		}
+
+		value, ok := keyring[secretPath]
+		if !ok {
+			value, ok = lookupPath(keyring, strings.Split(secretPath, "/"))
+		}
+
+		if !ok || value == nil {
+			return "", false, nil
+		}
+
+		return fmt.Sprint(value), true, nil
+	})
+}
+
+// VaultSecrets reads secrets from the KV version 2 engine mounted at mount of the Vault
+// server at addr, where the last segment of a path is a field of the secret at the rest,
+// e.g. `telegram/token` is the field `token` of the secret `telegram`. An empty addr or
+// token defaults to the VAULT_ADDR or VAULT_TOKEN env var, read once.
+func VaultSecrets(addr, token, mount string) SecretBackend {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	return SecretBackendFunc(func(secretPath string) (string, bool, error) {
+		index := strings.LastIndex(secretPath, "/")
+		if index <= 0 {
+			return "", false, fmt.Errorf("%w: %s: expected secret/field", ErrInvalidSecret, secretPath)
+		}
+
+		endpoint := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimRight(addr, "/"), strings.Trim(mount, "/"), secretPath[:index])
+
+		req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+		if err != nil {
+			return "", false, err
+		}
+
+		req.Header.Set("X-Vault-Token", token)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", false, err
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return "", false, nil
+		case resp.StatusCode != http.StatusOK:
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+			return "", false, fmt.Errorf("vault: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+		}
+
+		var body struct {
+			Data struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"data"`
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return "", false, fmt.Errorf("vault: %w", err)
+		}
+
+		value, ok := body.Data.Data[secretPath[index+1:]]
+		if !ok || value == nil {
+			return "", false, nil
+		}
+
+		return fmt.Sprint(value), true, nil
+	})
+}
+
+// VaultStandIn serves the read API of a Vault KV version 2 engine from memory, for local
+// development and tests: mount it with httptest or http.ListenAndServe and point
+// VaultSecrets at it. secrets maps secret paths, including the mount, to their fields,
+// e.g. {"secret/telegram": {"token": "..."}}. Requests must carry token.
+func VaultStandIn(token string, secrets map[string]map[string]interface{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != token {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+
+			return
+		}
+
+		mount, secretPath, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/"), "/data/")
+		if !ok || r.Method != http.MethodGet {
+			http.Error(w, `{"errors":["unsupported path"]}`, http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		secretPath, _ = url.PathUnescape(secretPath)
+
+		fields, ok := secrets[mount+"/"+secretPath]
+		if !ok {
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"data": fields, "metadata": map[string]interface{}{"version": 1}},
+		})
+	})
+}
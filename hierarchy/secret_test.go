@@ -0,0 +1,125 @@
+package hierarchy
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResolveSecretUnlocked(t *testing.T) {
+	release := make(chan struct{})
+	calls := 0
+
+	RegisterSecretBackend("slow", SecretBackendFunc(func(path string) (string, bool, error) {
+		if path == "blocked" {
+			<-release
+		}
+
+		calls++
+
+		return "value", true, nil
+	}))
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_, _, _ = resolveSecret("slow:blocked")
+	}()
+
+	// Lookups of other keys do not wait for a slow backend.
+	resolved := make(chan struct{})
+
+	go func() {
+		defer close(resolved)
+
+		if value, ok, err := resolveSecret("slow:other"); value != "value" || !ok || err != nil {
+			t.Errorf("resolveSecret(other) = %q, %v, %v", value, ok, err)
+		}
+	}()
+
+	select {
+	case <-resolved:
+	case <-time.After(5 * time.Second):
+		t.Fatal("resolveSecret(other) blocked behind a slow backend")
+	}
+
+	close(release)
+	<-done
+
+	// Both lookups are cached.
+	_, _, _ = resolveSecret("slow:blocked")
+	_, _, _ = resolveSecret("slow:other")
+
+	if calls != 2 {
+		t.Errorf("backend called %d times, want 2", calls)
+	}
+}
+
+func TestVaultSecrets(t *testing.T) {
+	server := httptest.NewServer(VaultStandIn("root", map[string]map[string]interface{}{
+		"secret/telegram": {"token": "123:abc"},
+	}))
+	defer server.Close()
+
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+
+	backend := VaultSecrets("", "", "secret")
+
+	// The env vars are read once, when the backend is made.
+	t.Setenv("VAULT_TOKEN", "changed")
+
+	if value, ok, err := backend.Secret("telegram/token"); value != "123:abc" || !ok || err != nil {
+		t.Errorf("Secret(telegram/token) = %q, %v, %v", value, ok, err)
+	}
+
+	if _, ok, err := backend.Secret("telegram/missing"); ok || err != nil {
+		t.Errorf("Secret(telegram/missing) = %v, %v, want not found", ok, err)
+	}
+}
+
+func TestWritesSkipSecrets(t *testing.T) {
+	unreachable := errors.New("vault unreachable")
+	calls := 0
+
+	RegisterSecretBackend("unreachable", SecretBackendFunc(func(string) (string, bool, error) {
+		calls++
+
+		return "", false, unreachable
+	}))
+
+	schema, err := CompileSchema("telegram.yaml", []byte("properties:\n  token: {type: string, minLength: 8}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := New()
+	h.RegisterSchema("telegram", schema)
+
+	if err := h.LoadAssetMap(map[string][]byte{
+		"app.yaml": []byte("telegram:\n  token: ${secret:unreachable:telegram/token}\n  url: https://${telegram.token}@api\n"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := h.SetE("logger.level", "debug"); err != nil {
+			t.Errorf("SetE(logger.level) error = %v", err)
+		}
+	}
+
+	if err := h.SetE("telegram.url", NewReference("${vaultish:url}")); !errors.Is(err, ErrUnresolvedReference) {
+		t.Errorf("SetE with an unknown namespace error = %v, want %v", err, ErrUnresolvedReference)
+	}
+
+	if calls != 0 {
+		t.Errorf("writes called the backend %d times, want 0", calls)
+	}
+
+	if err := h.Resolve(); !errors.Is(err, unreachable) {
+		t.Errorf("Resolve() = %v, want %v", err, unreachable)
+	}
+}
@@ -0,0 +1,525 @@
+package hierarchy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrIndexOutOfRange = errors.New("array index out of range")
+
+// appendSegment addresses the item past the end of an array, which Set appends, e.g. `hooks[+]`.
+const appendSegment = "+"
+
+// The hierarchy keeps every source in its layers so that it controls how they merge.
+// The embedded viper only parses the config files of ReadInConfig and the like.
+
+// layers is an immutable version of the sources held by the hierarchy. Writes modify
+// a clone under the write lock, then publish it, so reads never lock nor see a partial write.
+type layers struct {
+	// flagDefaults holds the defaults of the bound flags that were not given.
+	flagDefaults map[string]interface{}
+	defaults     map[string]interface{}
+	config       map[string]interface{}
+	override     map[string]interface{}
+	env          map[string]interface{}
+	envVars      []EnvVar
+	// flags holds the values of the given bound flags and set flags, see AddSetFlags.
+	flags   map[string]interface{}
+	origins map[string][]Origin
+	// cases maps lowercased paths to the original case of their last key, when it had uppercase.
+	cases map[string]string
+	// sensitive holds the lowercased paths of the values decrypted from assets.
+	sensitive map[string]bool
+	// reads holds the settings last read from each config file by ReadInConfig.
+	reads map[string]map[string]interface{}
+	// merges holds the arrays merged by each asset or file, by path, see mergeConfig.
+	// They are replaced, never modified.
+	merges map[string]map[string]arrayMerge
+	// aliases maps the aliases of RegisterAlias to their keys.
+	aliases map[string]string
+	// tree merges the layers above once written, see update. Reads share it, so it is
+	// never modified. A clone keeps the tree of its original until it is written.
+	tree map[string]interface{}
+}
+
+func newLayers() *layers {
+	return &layers{
+		flagDefaults: make(map[string]interface{}),
+		defaults:     make(map[string]interface{}),
+		config:       make(map[string]interface{}),
+		override:     make(map[string]interface{}),
+		env:          make(map[string]interface{}),
+		flags:        make(map[string]interface{}),
+		origins:      make(map[string][]Origin),
+		cases:        make(map[string]string),
+		sensitive:    make(map[string]bool),
+		reads:        make(map[string]map[string]interface{}),
+		merges:       make(map[string]map[string]arrayMerge),
+		aliases:      make(map[string]string),
+		tree:         make(map[string]interface{}),
+	}
+}
+
+func (l *layers) clone() *layers {
+	origins := make(map[string][]Origin, len(l.origins))
+	for key, o := range l.origins {
+		// Capping the capacity makes appends to the clone copy the origins.
+		origins[key] = o[:len(o):len(o)]
+	}
+
+	cases := make(map[string]string, len(l.cases))
+	for path, key := range l.cases {
+		cases[path] = key
+	}
+
+	sensitive := make(map[string]bool, len(l.sensitive))
+	for path := range l.sensitive {
+		sensitive[path] = true
+	}
+
+	// Reads are replaced, never modified.
+	reads := make(map[string]map[string]interface{}, len(l.reads))
+	for name, settings := range l.reads {
+		reads[name] = settings
+	}
+
+	merges := make(map[string]map[string]arrayMerge, len(l.merges))
+	for source, arrays := range l.merges {
+		merges[source] = arrays
+	}
+
+	aliases := make(map[string]string, len(l.aliases))
+	for alias, key := range l.aliases {
+		aliases[alias] = key
+	}
+
+	return &layers{
+		flagDefaults: copyMap(l.flagDefaults),
+		defaults:     copyMap(l.defaults),
+		config:       copyMap(l.config),
+		override:     copyMap(l.override),
+		env:          copyMap(l.env),
+		envVars:      l.envVars[:len(l.envVars):len(l.envVars)],
+		flags:        copyMap(l.flags),
+		origins:      origins,
+		cases:        cases,
+		sensitive:    sensitive,
+		reads:        reads,
+		merges:       merges,
+		aliases:      aliases,
+		tree:         l.tree,
+	}
+}
+
+// splitKey splits a key into lowercased path segments. Array items are addressed by index,
+// dotted or in brackets: `hooks.0.type`, `hooks[0].type`, or `hooks[-1]` for the last one.
+func splitKey(key string) []string {
+	return splitPath(strings.ToLower(key))
+}
+
+// splitPath splits a key into path segments, keeping their case.
+func splitPath(key string) []string {
+	path := make([]string, 0, strings.Count(key, ".")+1)
+	start := 0
+
+	for index := 0; index < len(key); index++ {
+		switch key[index] {
+		case '.', '[', ']':
+			if index > start {
+				path = append(path, key[start:index])
+			}
+
+			start = index + 1
+		}
+	}
+
+	if start < len(key) {
+		path = append(path, key[start:])
+	}
+
+	return path
+}
+
+// arrayIndex resolves an index segment against an array of length n. Negative indices
+// count from the end, and appendSegment is n.
+func arrayIndex(segment string, n int) (int, bool) {
+	if segment == appendSegment {
+		return n, true
+	}
+
+	index, err := strconv.Atoi(segment)
+	if err != nil {
+		return 0, false
+	}
+
+	if index < 0 {
+		index += n
+	}
+
+	return index, index >= 0 && index < n
+}
+
+// isIndexSegment reports whether segment is an array index, which may be negative.
+func isIndexSegment(segment string) bool {
+	return segment == appendSegment || isIndex(strings.TrimPrefix(segment, "-"))
+}
+
+// lookupPath walks path through maps and, with index segments, through arrays.
+func lookupPath(value interface{}, path []string) (interface{}, bool) {
+	for _, segment := range path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			child, ok := v[segment]
+			if !ok {
+				return nil, false
+			}
+
+			value = child
+		case []interface{}:
+			index, ok := arrayIndex(segment, len(v))
+			if !ok || index >= len(v) {
+				return nil, false
+			}
+
+			value = v[index]
+		default:
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// setPath sets value at path in m, replacing anything that is not a map on the way.
+func setPath(m map[string]interface{}, path []string, value interface{}) {
+	if len(path) == 0 {
+		return
+	}
+
+	for _, segment := range path[:len(path)-1] {
+		child, ok := m[segment].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			m[segment] = child
+		}
+
+		m = child
+	}
+
+	m[path[len(path)-1]] = value
+}
+
+// setKey sets value at path in layer. Layers hold no partial arrays, so when path goes
+// through an array of base, the array is copied from base with the item set, then
+// replaces the array in layer. A tombstone set on an array item removes it.
+func setKey(layer, base map[string]interface{}, path []string, value interface{}) error {
+	var node interface{} = base
+
+	for index, segment := range path {
+		if _, ok := node.([]interface{}); ok || segment == appendSegment || node == nil && isIndexSegment(segment) {
+			items, err := setIn(copyValue(node), path[index:], value)
+			if err != nil {
+				return fmt.Errorf("%w: %s", err, strings.Join(path, "."))
+			}
+
+			setPath(layer, path[:index], items)
+
+			return nil
+		}
+
+		node, _ = lookupPath(node, path[index:index+1])
+	}
+
+	setPath(layer, path, value)
+
+	return nil
+}
+
+// setIn sets value at path in node, which it modifies, creating maps and arrays on the way.
+func setIn(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	switch v := node.(type) {
+	case []interface{}:
+		deleting := len(path) == 1 && isTombstone(value)
+
+		// The index past the last item appends, unless deleting.
+		index, ok := arrayIndex(path[0], len(v))
+		if !ok && index != len(v) || deleting && index == len(v) {
+			return nil, ErrIndexOutOfRange
+		}
+
+		if deleting {
+			return append(v[:index:index], v[index+1:]...), nil
+		}
+
+		if index == len(v) {
+			v = append(v, nil)
+		}
+
+		child, err := setIn(v[index], path[1:], value)
+		v[index] = child
+
+		return v, err
+	case map[string]interface{}:
+		if len(path) == 1 && isTombstone(value) {
+			delete(v, path[0])
+
+			return v, nil
+		}
+
+		child, err := setIn(v[path[0]], path[1:], value)
+		v[path[0]] = child
+
+		return v, err
+	case nil:
+		if isIndexSegment(path[0]) {
+			// A missing array is an empty one.
+			return setIn([]interface{}{}, path, value)
+		}
+
+		return setIn(make(map[string]interface{}), path, value)
+	default:
+		return setIn(make(map[string]interface{}), path, value)
+	}
+}
+
+// mergeTree deeply merges src into dst. Tombstones of src are kept in dst when
+// keepTombstones is set, so that they hide lower layers, and delete the key otherwise.
+func mergeTree(dst, src map[string]interface{}, keepTombstones bool) {
+	for key, value := range src {
+		if isTombstone(value) {
+			if keepTombstones {
+				dst[key] = value
+			} else {
+				delete(dst, key)
+			}
+
+			continue
+		}
+
+		srcMap, srcOK := value.(map[string]interface{})
+		if !srcOK {
+			dst[key] = copyValue(value)
+
+			continue
+		}
+
+		dstMap, dstOK := dst[key].(map[string]interface{})
+		if !dstOK {
+			dstMap = make(map[string]interface{}, len(srcMap))
+			dst[key] = dstMap
+		}
+
+		mergeTree(dstMap, srcMap, keepTombstones)
+	}
+}
+
+// copyValue deeply copies the maps and arrays of value.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[key] = copyValue(child)
+		}
+
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for index, child := range v {
+			items[index] = copyValue(child)
+		}
+
+		return items
+	default:
+		return value
+	}
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	c, _ := copyValue(m).(map[string]interface{})
+
+	return c
+}
+
+// insensitivise lowercases the keys of value, including maps nested in arrays.
+func insensitivise(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[strings.ToLower(key)] = insensitivise(child)
+		}
+
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for index, child := range v {
+			items[index] = insensitivise(child)
+		}
+
+		return items
+	default:
+		if m, ok := toStringMap(value); ok {
+			return insensitivise(m)
+		}
+
+		return value
+	}
+}
+
+// flattenKeys returns the dotted keys of the leaves of m; arrays are leaves.
+func flattenKeys(m map[string]interface{}, prefix string, keys []string) []string {
+	for key, value := range m {
+		path := joinPath(prefix, key)
+
+		if child, ok := value.(map[string]interface{}); ok && len(child) > 0 {
+			keys = flattenKeys(child, path, keys)
+
+			continue
+		}
+
+		keys = append(keys, path)
+	}
+
+	return keys
+}
+
+// tree returns the merged tree of the current layers, which must not be modified.
+func (h *Hierarchy) tree() map[string]interface{} {
+	if h.root != nil {
+		subtree, _ := lookupPath(h.root.tree(), splitKey(h.prefix))
+		if m, ok := subtree.(map[string]interface{}); ok {
+			return m
+		}
+
+		return make(map[string]interface{})
+	}
+
+	return h.current.Load().tree
+}
+
+// treeOf merges the layers of l, from lowest to highest precedence: defaults of bound
+// flags, defaults, config, env vars, given bound flags and set flags, then Set overrides.
+// Reads use the tree merged once by update instead; writes use treeOf while they apply.
+func (h *Hierarchy) treeOf(l *layers) map[string]interface{} {
+	tree := make(map[string]interface{})
+
+	for _, layer := range []map[string]interface{}{l.flagDefaults, l.defaults, l.config, l.env, l.flags, l.override} {
+		mergeTree(tree, layer, false)
+	}
+
+	return tree
+}
+
+// raw returns the unresolved value of key.
+func (h *Hierarchy) raw(key string) (interface{}, bool) {
+	if h.root != nil {
+		return h.root.raw(h.absolute(key))
+	}
+
+	l := h.current.Load()
+
+	value, ok := lookupPath(l.tree, splitKey(l.realKey(key)))
+	if !ok || value == nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+// IsSet checks to see if a key is set.
+func (h *Hierarchy) IsSet(key string) bool {
+	_, ok := h.raw(key)
+
+	return ok
+}
+
+// AllKeys returns the keys of all leaves.
+func (h *Hierarchy) AllKeys() []string {
+	keys := flattenKeys(h.tree(), "", nil)
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Set sets the value for a key, overriding every other source. Setting an array item,
+// e.g. `hooks[0].level` or `hooks[+]` to append, overrides the whole array. Errors, such
+// as an index out of range, are logged; see SetE.
+func (h *Hierarchy) Set(key string, value interface{}) {
+	if err := h.SetE(key, value); err != nil {
+		log.Printf("hierarchy: %v", err)
+	}
+}
+
+func SetE(key string, value interface{}) error {
+	return _default.SetE(key, value)
+}
+
+// SetE is like Set, but returns its error. An index addresses an existing array item, or
+// appends when it is the length of the array, like `+`; a missing array is empty. Any
+// other index is ErrIndexOutOfRange.
+func (h *Hierarchy) SetE(key string, value interface{}) error {
+	if h.root != nil {
+		return h.root.SetE(h.absolute(key), value)
+	}
+
+	original, value := value, insensitivise(value)
+	origin := callOrigin(SourceSet)
+
+	return h.update(func(l *layers) error {
+		key := l.realKey(key)
+		path := splitKey(key)
+		if err := setKey(l.override, h.treeOf(l), path, value); err != nil {
+			return err
+		}
+
+		l.record(strings.Join(path, "."), value, origin)
+		l.recordKeyCase(key)
+		l.recordCases(strings.Join(path, "."), original)
+
+		return nil
+	})
+}
+
+// SetDefault sets the default value for a key. Errors are logged; see SetDefaultE.
+func (h *Hierarchy) SetDefault(key string, value interface{}) {
+	if err := h.SetDefaultE(key, value); err != nil {
+		log.Printf("hierarchy: %v", err)
+	}
+}
+
+func SetDefaultE(key string, value interface{}) error {
+	return _default.SetDefaultE(key, value)
+}
+
+// SetDefaultE is like SetDefault, but returns its error, see SetE.
+func (h *Hierarchy) SetDefaultE(key string, value interface{}) error {
+	if h.root != nil {
+		return h.root.SetDefaultE(h.absolute(key), value)
+	}
+
+	original, value := value, insensitivise(value)
+	origin := callOrigin(SourceDefault)
+
+	return h.update(func(l *layers) error {
+		key := l.realKey(key)
+		path := splitKey(key)
+		if err := setKey(l.defaults, l.defaults, path, value); err != nil {
+			return err
+		}
+
+		l.record(strings.Join(path, "."), value, origin)
+		l.recordKeyCase(key)
+		l.recordCases(strings.Join(path, "."), original)
+
+		return nil
+	})
+}
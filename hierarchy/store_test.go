@@ -0,0 +1,122 @@
+package hierarchy
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSetIndexes(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    interface{}
+		wantErr bool
+	}{
+		{key: "hooks[1].type", want: []interface{}{
+			map[string]interface{}{"type": "file"},
+			map[string]interface{}{"type": "set"},
+		}},
+		{key: "hooks[2].type", want: []interface{}{
+			map[string]interface{}{"type": "file"},
+			map[string]interface{}{"type": "telegram"},
+			map[string]interface{}{"type": "set"},
+		}},
+		{key: "hooks[+].type", want: []interface{}{
+			map[string]interface{}{"type": "file"},
+			map[string]interface{}{"type": "telegram"},
+			map[string]interface{}{"type": "set"},
+		}},
+		{key: "hooks[-1].type", want: []interface{}{
+			map[string]interface{}{"type": "file"},
+			map[string]interface{}{"type": "set"},
+		}},
+		{key: "hooks[5].type", wantErr: true},
+		{key: "hooks[-3].type", wantErr: true},
+		{key: "missing[0]", want: []interface{}{"set"}},
+		{key: "missing[+]", want: []interface{}{"set"}},
+		{key: "missing[1]", wantErr: true},
+		{key: "missing[0][0]", want: []interface{}{[]interface{}{"set"}}},
+	}
+
+	for _, test := range tests {
+		h := New()
+		if err := h.MergeConfigMap(map[string]interface{}{
+			"hooks": []interface{}{
+				map[string]interface{}{"type": "file"},
+				map[string]interface{}{"type": "telegram"},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		err := h.SetE(test.key, "set")
+		if test.wantErr {
+			if !errors.Is(err, ErrIndexOutOfRange) {
+				t.Errorf("SetE(%s) error = %v, want ErrIndexOutOfRange", test.key, err)
+			}
+
+			if h.IsSet("missing") {
+				t.Errorf("SetE(%s) failed but set %v", test.key, h.Get("missing"))
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("SetE(%s) error = %v", test.key, err)
+
+			continue
+		}
+
+		path := splitKey(test.key)
+		if got := h.Get(path[0]); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SetE(%s): %s = %#v, want %#v", test.key, path[0], got, test.want)
+		}
+	}
+}
+
+func TestDeleteIndexes(t *testing.T) {
+	h := New()
+	h.Set("levels", []interface{}{"info", "warn", "error"})
+
+	if err := h.DeleteE("levels[1]"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := h.GetStringSlice("levels"), []string{"info", "error"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("levels = %v, want %v", got, want)
+	}
+
+	for _, key := range []string{"levels[2]", "levels[+]", "missing[0]"} {
+		if err := h.DeleteE(key); !errors.Is(err, ErrIndexOutOfRange) {
+			t.Errorf("DeleteE(%s) error = %v, want ErrIndexOutOfRange", key, err)
+		}
+	}
+
+	if err := h.DeleteE("missing"); err != nil || h.IsSet("missing") {
+		t.Errorf("DeleteE(missing) = %v", err)
+	}
+}
+
+func TestLoadEnvIndexes(t *testing.T) {
+	h := New()
+
+	for index, port := range []string{"80", "81", "82", "83", "84", "85", "86", "87", "88", "89", "90", "91"} {
+		t.Setenv(fmt.Sprintf("LIBRATEST_PORTS_%d", index), port)
+	}
+
+	if err := h.LoadEnv("LIBRATEST"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := h.GetStringSlice("ports"); len(got) != 12 || got[10] != "90" {
+		t.Errorf("ports = %v, want 12 ports in order", got)
+	}
+
+	t.Setenv("LIBRATEST_HOSTS_1", "b")
+
+	if err := h.LoadEnv("LIBRATEST"); !errors.Is(err, ErrInvalidEnv) {
+		t.Errorf("LoadEnv with a gap error = %v, want ErrInvalidEnv", err)
+	}
+}
@@ -0,0 +1,506 @@
+package hierarchy
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrRequiredKeyMissing = errors.New("required key missing")
+	ErrDecodeTarget       = errors.New("decode target should be a non-nil pointer")
+)
+
+// tagName is the struct tag read by Decode and FromStruct, e.g. `libra:"name,default=1s,required"`.
+const tagName = "libra"
+
+type fieldTag struct {
+	name       string
+	defaultVal string
+	hasDefault bool
+	required   bool
+	squash     bool
+	skip       bool
+}
+
+func parseFieldTag(field reflect.StructField) fieldTag {
+	tag := fieldTag{name: field.Name}
+
+	value, ok := field.Tag.Lookup(tagName)
+	if !ok {
+		tag.squash = field.Anonymous
+
+		return tag
+	}
+
+	if value == "-" {
+		tag.skip = true
+
+		return tag
+	}
+
+	parts := strings.Split(value, ",")
+	if parts[0] != "" {
+		tag.name = parts[0]
+	} else {
+		tag.squash = field.Anonymous
+	}
+
+	for _, part := range parts[1:] {
+		switch {
+		case part == "required":
+			tag.required = true
+		case part == "squash":
+			tag.squash = true
+		case strings.HasPrefix(part, "default="):
+			tag.defaultVal = strings.TrimPrefix(part, "default=")
+			tag.hasDefault = true
+		}
+	}
+
+	return tag
+}
+
+// DecodeError reports every problem found by Decode rather than only the first one.
+type DecodeError struct {
+	Missing []string
+	Errors  []error
+}
+
+func (e *DecodeError) Error() string {
+	messages := make([]string, 0, len(e.Errors)+1)
+	if len(e.Missing) > 0 {
+		messages = append(messages, fmt.Sprintf("%s: %s", ErrRequiredKeyMissing, strings.Join(e.Missing, ", ")))
+	}
+
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e *DecodeError) Is(target error) bool {
+	if target == ErrRequiredKeyMissing && len(e.Missing) > 0 {
+		return true
+	}
+
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *DecodeError) empty() bool {
+	return len(e.Missing) == 0 && len(e.Errors) == 0
+}
+
+func Decode(v interface{}) error {
+	return _default.Decode(v)
+}
+
+// Decode decodes the hierarchy into v, which must be a pointer, honoring libra struct tags,
+// then checks its `validate` tags.
+func (h *Hierarchy) Decode(v interface{}) error {
+	if err := decode(h.AllSettings(), v); err != nil {
+		return err
+	}
+
+	return h.checkConstraints("", v)
+}
+
+func decode(in interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("%w: %T", ErrDecodeTarget, v)
+	}
+
+	d := &decoder{err: &DecodeError{}}
+	d.decode("", in, rv.Elem())
+
+	if d.err.empty() {
+		return nil
+	}
+
+	return d.err
+}
+
+type decoder struct {
+	err *DecodeError
+}
+
+func (d *decoder) fail(path string, err error) {
+	if path == "" {
+		d.err.Errors = append(d.err.Errors, err)
+
+		return
+	}
+
+	d.err.Errors = append(d.err.Errors, fmt.Errorf("%s: %w", path, err))
+}
+
+func (d *decoder) decode(path string, in interface{}, out reflect.Value) {
+	if in == nil {
+		return
+	}
+
+	t := out.Type()
+
+	if t.Kind() == reflect.Ptr {
+		if out.IsNil() {
+			out.Set(reflect.New(t.Elem()))
+		}
+
+		d.decode(path, in, out.Elem())
+
+		return
+	}
+
+	if isScalarType(t) {
+		v, err := convertScalar(in, t)
+		if err != nil {
+			d.fail(path, err)
+
+			return
+		}
+
+		out.Set(v)
+
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		out.Set(reflect.ValueOf(in))
+	case reflect.Struct:
+		d.decodeStruct(path, in, out)
+	case reflect.Map:
+		d.decodeMap(path, in, out)
+	case reflect.Slice:
+		d.decodeSlice(path, in, out)
+	case reflect.Array:
+		d.decodeArray(path, in, out)
+	default:
+		d.fail(path, fmt.Errorf("%w: %s", ErrUnsupportedType, t))
+	}
+}
+
+func (d *decoder) decodeStruct(path string, in interface{}, out reflect.Value) {
+	m, ok := toStringMap(in)
+	if !ok {
+		d.fail(path, fmt.Errorf("%w: got %T", ErrHierachyShouldBeMap, in))
+
+		return
+	}
+
+	t := out.Type()
+	for index := 0; index < t.NumField(); index++ {
+		field := t.Field(index)
+		if !isVisibleField(field) {
+			continue
+		}
+
+		tag := parseFieldTag(field)
+		if tag.skip {
+			continue
+		}
+
+		fieldValue := out.Field(index)
+
+		if tag.squash && indirectType(field.Type).Kind() == reflect.Struct {
+			d.decode(path, m, fieldValue)
+
+			continue
+		}
+
+		childPath := joinPath(path, tag.name)
+
+		value, ok := lookupFold(m, tag.name)
+
+		switch {
+		case ok && value != nil:
+			d.decode(childPath, value, fieldValue)
+		case tag.hasDefault:
+			d.decode(childPath, tag.defaultVal, fieldValue)
+		case tag.required:
+			d.err.Missing = append(d.err.Missing, childPath)
+		case field.Type.Kind() == reflect.Struct && !isScalarType(field.Type):
+			// Visit absent nested structs so their defaults and required keys apply.
+			d.decode(childPath, map[string]interface{}{}, fieldValue)
+		}
+	}
+}
+
+func (d *decoder) decodeMap(path string, in interface{}, out reflect.Value) {
+	m, ok := toStringMap(in)
+	if !ok {
+		d.fail(path, fmt.Errorf("%w: got %T", ErrHierachyShouldBeMap, in))
+
+		return
+	}
+
+	t := out.Type()
+	if out.IsNil() {
+		out.Set(reflect.MakeMapWithSize(t, len(m)))
+	}
+
+	for key, value := range m {
+		childPath := joinPath(path, key)
+
+		k, err := convertScalar(key, t.Key())
+		if err != nil {
+			d.fail(childPath, err)
+
+			continue
+		}
+
+		v := reflect.New(t.Elem()).Elem()
+		d.decode(childPath, value, v)
+		out.SetMapIndex(k, v)
+	}
+}
+
+func (d *decoder) decodeSlice(path string, in interface{}, out reflect.Value) {
+	items, ok := toSlice(in)
+	if !ok {
+		// A single value is accepted where a list is expected, e.g. `level: info`.
+		items = []interface{}{in}
+	}
+
+	slice := reflect.MakeSlice(out.Type(), len(items), len(items))
+	for index, item := range items {
+		d.decode(joinPath(path, fmt.Sprint(index)), item, slice.Index(index))
+	}
+
+	out.Set(slice)
+}
+
+func (d *decoder) decodeArray(path string, in interface{}, out reflect.Value) {
+	items, ok := toSlice(in)
+	if !ok {
+		d.fail(path, fmt.Errorf("%w: expected array, got %T", ErrConvertFailed, in))
+
+		return
+	}
+
+	if len(items) > out.Len() {
+		d.fail(path, fmt.Errorf("%w: %d items into %s", ErrConvertFailed, len(items), out.Type()))
+
+		return
+	}
+
+	for index, item := range items {
+		d.decode(joinPath(path, fmt.Sprint(index)), item, out.Index(index))
+	}
+}
+
+func FromStruct(v interface{}) (*Hierarchy, error) {
+	encoded, ok := encode(reflect.ValueOf(v))
+	if !ok {
+		return nil, fmt.Errorf("%w: got %T", ErrHierachyShouldBeMap, v)
+	}
+
+	m, ok := encoded.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: got %T", ErrHierachyShouldBeMap, v)
+	}
+
+	h := New()
+	if err := h.MergeConfigMap(m); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// encode turns v into the maps, slices and scalars a hierarchy is made of.
+// It returns false for values that should be left out, such as nil pointers.
+func encode(v reflect.Value) (interface{}, bool) {
+	if !v.IsValid() {
+		return nil, false
+	}
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+
+		v = v.Elem()
+	}
+
+	switch v.Type() {
+	case durationType:
+		return v.Interface().(time.Duration).String(), true
+	case timeType:
+		return v.Interface(), true
+	}
+
+	if v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err == nil {
+			return string(text), true
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		encodeStruct(v, m)
+
+		return m, true
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+
+		iter := v.MapRange()
+		for iter.Next() {
+			if value, ok := encode(iter.Value()); ok {
+				m[fmt.Sprint(iter.Key().Interface())] = value
+			}
+		}
+
+		return m, true
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, false
+		}
+
+		items := make([]interface{}, 0, v.Len())
+		for index := 0; index < v.Len(); index++ {
+			value, _ := encode(v.Index(index))
+			items = append(items, value)
+		}
+
+		return items, true
+	default:
+		return v.Interface(), true
+	}
+}
+
+func encodeStruct(v reflect.Value, m map[string]interface{}) {
+	t := v.Type()
+	for index := 0; index < t.NumField(); index++ {
+		field := t.Field(index)
+		if !isVisibleField(field) {
+			continue
+		}
+
+		tag := parseFieldTag(field)
+		if tag.skip {
+			continue
+		}
+
+		fieldValue := v.Field(index)
+
+		if tag.squash && indirectType(field.Type).Kind() == reflect.Struct {
+			for fieldValue.Kind() == reflect.Ptr {
+				if fieldValue.IsNil() {
+					break
+				}
+
+				fieldValue = fieldValue.Elem()
+			}
+
+			if fieldValue.Kind() == reflect.Struct {
+				encodeStruct(fieldValue, m)
+			}
+
+			continue
+		}
+
+		if value, ok := encode(fieldValue); ok {
+			m[tag.name] = value
+		}
+	}
+}
+
+// isVisibleField reports whether field is exported, or embeds a struct whose exported
+// fields are promoted, as encoding/json does.
+func isVisibleField(field reflect.StructField) bool {
+	return field.IsExported() || field.Anonymous && field.Type.Kind() == reflect.Struct
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// lookupFold finds key in m ignoring case, since viper lowercases every key.
+func lookupFold(m map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := m[key]; ok {
+		return value, true
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if strings.EqualFold(k, key) {
+			return m[k], true
+		}
+	}
+
+	return nil, false
+}
+
+func toStringMap(in interface{}) (map[string]interface{}, bool) {
+	switch m := in.(type) {
+	case map[string]interface{}:
+		return m, true
+	case *Hierarchy:
+		return m.AllSettings(), true
+	}
+
+	v := reflect.ValueOf(in)
+	if v.Kind() != reflect.Map {
+		return nil, false
+	}
+
+	m := make(map[string]interface{}, v.Len())
+
+	iter := v.MapRange()
+	for iter.Next() {
+		m[fmt.Sprint(iter.Key().Interface())] = iter.Value().Interface()
+	}
+
+	return m, true
+}
+
+func toSlice(in interface{}) ([]interface{}, bool) {
+	if items, ok := in.([]interface{}); ok {
+		return items, true
+	}
+
+	v := reflect.ValueOf(in)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	items := make([]interface{}, v.Len())
+	for index := range items {
+		items[index] = v.Index(index).Interface()
+	}
+
+	return items, true
+}
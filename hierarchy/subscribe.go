@@ -0,0 +1,113 @@
+package hierarchy
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Subscriber receives the previous and current resolved value of a subscribed key,
+// nil meaning unset. For a subtree, the values are maps.
+type Subscriber func(old, new interface{})
+
+type subscription struct {
+	key string
+	fn  Subscriber
+}
+
+func Subscribe(key string, fn Subscriber) func() {
+	return _default.Subscribe(key, fn)
+}
+
+// Subscribe calls fn after every Set, SetDefault, Delete, MergeConfigMap or asset load
+// that changes the resolved value of key or of any key under it. Callbacks run once the
+// whole update is applied, so they see a consistent hierarchy. Concurrent writes may
+// run callbacks concurrently. It returns a function that cancels the subscription.
+func (h *Hierarchy) Subscribe(key string, fn Subscriber) func() {
+	if h.root != nil {
+		return h.root.Subscribe(h.absolute(key), fn)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &subscription{key: key, fn: fn}
+	h.subscriptions = append(h.subscriptions, sub)
+
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		for index, s := range h.subscriptions {
+			if s == sub {
+				h.subscriptions = append(h.subscriptions[:index:index], h.subscriptions[index+1:]...)
+
+				return
+			}
+		}
+	}
+}
+
+// update applies a change to a clone of the layers and publishes it, unless the change
+// fails part way, breaks references, see checkReferences, or violates registered schemas,
+// see checkSchemas. It then notifies the subscribers of the keys it changed.
+func (h *Hierarchy) update(apply func(next *layers) error) error {
+	return h.write(apply, false)
+}
+
+// load is update for the loads of assets, which must satisfy registered schemas whole.
+func (h *Hierarchy) load(apply func(next *layers) error) error {
+	return h.write(apply, true)
+}
+
+func (h *Hierarchy) write(apply func(next *layers) error, strict bool) error {
+	if h.root != nil {
+		return h.root.write(apply, strict)
+	}
+
+	h.mu.Lock()
+
+	previous := h.current.Load()
+	next := previous.clone()
+
+	err := apply(next)
+	if err == nil {
+		next.tree = h.treeOf(next)
+		err = h.checkReferences(next)
+	}
+
+	if err == nil {
+		err = h.checkSchemas(previous, next, strict)
+	}
+
+	if err != nil {
+		h.mu.Unlock()
+
+		return err
+	}
+
+	h.current.Store(next)
+	subscriptions := append([]*subscription{}, h.subscriptions...)
+
+	h.mu.Unlock()
+
+	if len(subscriptions) > 0 {
+		h.notify(subscriptions, previous, next)
+	}
+
+	return nil
+}
+
+func (h *Hierarchy) notify(subscriptions []*subscription, previous, next *layers) {
+	before, after := h.settings(previous), h.settings(next)
+
+	for _, sub := range subscriptions {
+		path := splitKey(sub.key)
+		old, _ := lookupPath(before, path)
+		current, _ := lookupPath(after, path)
+
+		if !reflect.DeepEqual(old, current) {
+			key := strings.Join(path, ".")
+			sub.fn(h.cased(previous, key, old), h.cased(next, key, current))
+		}
+	}
+}
@@ -0,0 +1,673 @@
+package hierarchy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+var bareKeyExp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlEditor edits TOML line by line, so that comments and layout stay where they are.
+type tomlEditor struct {
+	lines []string
+}
+
+// tomlEntry is a key/value, spanning lines [start, end), or a table header with its section.
+type tomlEntry struct {
+	path       []string
+	start, end int
+	header     bool
+	// array tells a `[[table]]` header, or a key/value inside its section.
+	array bool
+	// valueStart is the offset in the first line of the value of a key/value.
+	valueStart int
+	comment    string
+}
+
+func newTOMLEditor(data []byte) *tomlEditor {
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return &tomlEditor{}
+	}
+
+	return &tomlEditor{lines: strings.Split(text, "\n")}
+}
+
+func (e *tomlEditor) bytes() ([]byte, error) {
+	if len(e.lines) == 0 {
+		return nil, nil
+	}
+
+	return []byte(strings.Join(e.lines, "\n") + "\n"), nil
+}
+
+// scan lists the entries of the document. The tables of an array of tables are addressed
+// by index like array items, e.g. `logger.hooks.1` and `logger.hooks.1.level`.
+func (e *tomlEditor) scan() []tomlEntry {
+	entries := make([]tomlEntry, 0)
+	table, array, header := []string(nil), false, -1
+	// items counts the tables of each array of tables, by indexed path.
+	items := make(map[string]int)
+
+	for index := 0; index < len(e.lines); index++ {
+		trimmed := strings.TrimSpace(e.lines[index])
+
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			continue
+		case strings.HasPrefix(trimmed, "["):
+			array = strings.HasPrefix(trimmed, "[[")
+			name := strings.Trim(trimmed[:strings.LastIndex(trimmed, "]")+1], "[]")
+			table = parseTOMLKey(name)
+
+			if array {
+				table = append(indexTables(table[:len(table)-1], items), table[len(table)-1])
+				key := strings.ToLower(strings.Join(table, "."))
+				table = append(table, strconv.Itoa(items[key]))
+				items[key]++
+			} else {
+				table = indexTables(table, items)
+			}
+
+			header = len(entries)
+			entries = append(entries, tomlEntry{path: table, start: index, end: index + 1, header: true, array: array})
+		default:
+			eq := tomlIndex(e.lines[index], 0, '=')
+			if eq < 0 {
+				continue
+			}
+
+			end, comment := e.valueEnd(index, eq+1)
+			path := append(table[:len(table):len(table)], parseTOMLKey(e.lines[index][:eq])...)
+			entries = append(entries, tomlEntry{
+				path: path, start: index, end: end, array: array, valueStart: eq + 1, comment: comment,
+			})
+
+			if header >= 0 {
+				entries[header].end = end
+			}
+
+			index = end - 1
+		}
+	}
+
+	return entries
+}
+
+// indexTables inserts the index of the last table of the arrays of tables in path, so that
+// `[a.b]` under `[[a]]` is the table `a.1.b` of the second one.
+func indexTables(path []string, items map[string]int) []string {
+	indexed := make([]string, 0, len(path))
+
+	for _, segment := range path {
+		indexed = append(indexed, segment)
+
+		if n, ok := items[strings.ToLower(strings.Join(indexed, "."))]; ok {
+			indexed = append(indexed, strconv.Itoa(n-1))
+		}
+	}
+
+	return indexed
+}
+
+// valueEnd returns the line past the value starting at col of line, which may span
+// lines in arrays, inline tables or multiline strings, and its trailing comment.
+func (e *tomlEditor) valueEnd(line, col int) (int, string) {
+	depth, quote := 0, ""
+
+	for ; line < len(e.lines); line++ {
+		text, comment := e.lines[line], ""
+
+	chars:
+		for index := col; index < len(text); index++ {
+			rest := text[index:]
+
+			switch {
+			case quote == `"` || quote == `"""`:
+				if rest[0] == '\\' {
+					index++
+				} else if strings.HasPrefix(rest, quote) {
+					index += len(quote) - 1
+					quote = ""
+				}
+			case quote != "":
+				if strings.HasPrefix(rest, quote) {
+					index += len(quote) - 1
+					quote = ""
+				}
+			case strings.HasPrefix(rest, `"""`), strings.HasPrefix(rest, `'''`):
+				quote = rest[:3]
+				index += 2
+			case rest[0] == '"' || rest[0] == '\'':
+				quote = rest[:1]
+			case rest[0] == '[' || rest[0] == '{':
+				depth++
+			case rest[0] == ']' || rest[0] == '}':
+				depth--
+			case rest[0] == '#':
+				comment = rest
+
+				break chars
+			}
+		}
+
+		if quote == `"` || quote == `'` {
+			quote = ""
+		}
+
+		if depth <= 0 && quote == "" {
+			return line + 1, comment
+		}
+
+		col = 0
+	}
+
+	return len(e.lines), ""
+}
+
+// tomlIndex returns the offset of c in text from col, outside of quoted keys or strings.
+func tomlIndex(text string, col int, c byte) int {
+	quote := byte(0)
+
+	for index := col; index < len(text); index++ {
+		switch {
+		case quote != 0:
+			if text[index] == '\\' && quote == '"' {
+				index++
+			} else if text[index] == quote {
+				quote = 0
+			}
+		case text[index] == '"' || text[index] == '\'':
+			quote = text[index]
+		case text[index] == c:
+			return index
+		}
+	}
+
+	return -1
+}
+
+// parseTOMLKey splits a dotted key such as `a."b.c".d` into its segments.
+func parseTOMLKey(text string) []string {
+	path := make([]string, 0)
+
+	for {
+		dot := tomlIndex(text, 0, '.')
+		if dot < 0 {
+			return append(path, unquoteTOMLKey(text))
+		}
+
+		path = append(path, unquoteTOMLKey(text[:dot]))
+		text = text[dot+1:]
+	}
+}
+
+func unquoteTOMLKey(key string) string {
+	key = strings.TrimSpace(key)
+
+	switch {
+	case strings.HasPrefix(key, `"`):
+		if unquoted, err := strconv.Unquote(key); err == nil {
+			return unquoted
+		}
+	case strings.HasPrefix(key, "'"):
+		return strings.Trim(key, "'")
+	}
+
+	return key
+}
+
+func hasPathPrefix(path, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+
+	for index, segment := range prefix {
+		if !strings.EqualFold(path[index], segment) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *tomlEditor) set(path []string, value interface{}) error {
+	if value == nil {
+		return e.delete(path)
+	}
+
+	entries := e.scan()
+
+	if items, ok := value.([]interface{}); ok && isTableArray(entries, path) && allMaps(items) {
+		return e.setTables(path, items)
+	}
+
+	for _, entry := range entries {
+		if entry.header || !hasPathPrefix(path, entry.path) {
+			continue
+		}
+
+		if len(entry.path) < len(path) {
+			// The key is inside an inline table or array, which is rewritten whole.
+			return e.setInline(entry, path[len(entry.path):], value)
+		}
+
+		if len(entry.path) == len(path) {
+			if current, err := e.inlineValue(entry); err == nil && tomlValue(current) == tomlValue(value) {
+				// An unchanged value keeps how it is written.
+				return nil
+			}
+
+			return e.replaceValue(entry, value)
+		}
+	}
+
+	// The key may be defined as a table, or an array of tables, which the value replaces.
+	if err := e.delete(path); err != nil {
+		return err
+	}
+
+	entries = e.scan()
+	table, at, indent := e.section(entries, path)
+
+	key := make([]string, 0, len(path)-len(table))
+	for _, segment := range path[len(table):] {
+		key = append(key, tomlKey(segment))
+	}
+
+	line := fmt.Sprintf("%s%s = %s", indent, strings.Join(key, "."), tomlValue(value))
+	e.lines = append(e.lines[:at], append([]string{line}, e.lines[at:]...)...)
+
+	return nil
+}
+
+// section returns the path of the deepest table holding path, the line where to add a
+// key to it and the indentation of its keys.
+func (e *tomlEditor) section(entries []tomlEntry, path []string) ([]string, int, string) {
+	table, at, indent, found := []string(nil), len(e.lines), "", false
+
+	for _, entry := range entries {
+		if entry.header && len(entry.path) < len(path) &&
+			hasPathPrefix(path, entry.path) && (!found || len(entry.path) > len(table)) {
+			table, at, found = entry.path, entry.end, true
+		}
+	}
+
+	if !found {
+		// Root keys go after the last one, or before the first table and its comments.
+		at = 0
+
+		for index, entry := range entries {
+			if entry.header {
+				if index == 0 {
+					at = entry.start
+					for at > 0 && strings.HasPrefix(strings.TrimSpace(e.lines[at-1]), "#") {
+						at--
+					}
+				}
+
+				break
+			}
+
+			at = entry.end
+		}
+
+		if len(entries) == 0 {
+			at = len(e.lines)
+		}
+	}
+
+	for _, entry := range entries {
+		if !entry.header && entry.end == at {
+			line := e.lines[entry.start]
+			indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		}
+	}
+
+	return table, at, indent
+}
+
+func (e *tomlEditor) replaceValue(entry tomlEntry, value interface{}) error {
+	line := e.lines[entry.start]
+	rest := line[entry.valueStart:]
+	prefix := line[:entry.valueStart] + rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))]
+
+	if prefix == line[:entry.valueStart] {
+		prefix += " "
+	}
+
+	replaced := prefix + tomlValue(value)
+	if entry.comment != "" {
+		replaced += " " + entry.comment
+	}
+
+	e.lines = append(e.lines[:entry.start], append([]string{replaced}, e.lines[entry.end:]...)...)
+
+	return nil
+}
+
+// inlineValue decodes the value of the key/value entry.
+func (e *tomlEditor) inlineValue(entry tomlEntry) (interface{}, error) {
+	text := strings.Join(e.lines[entry.start:entry.end], "\n")[entry.valueStart:]
+	if entry.comment != "" {
+		text = strings.TrimSuffix(strings.TrimRight(text, " \t"), entry.comment)
+	}
+
+	var doc map[string]interface{}
+	if err := toml.Unmarshal([]byte("v = "+text), &doc); err != nil {
+		return nil, err
+	}
+
+	return doc["v"], nil
+}
+
+// setInline sets value at path inside the inline value of entry.
+func (e *tomlEditor) setInline(entry tomlEntry, path []string, value interface{}) error {
+	current, err := e.inlineValue(entry)
+	if err != nil {
+		return err
+	}
+
+	inline, err := setInlineValue(current, path, value)
+	if err != nil {
+		return err
+	}
+
+	return e.replaceValue(entry, inline)
+}
+
+// isTableArray reports whether path is an array of tables in entries.
+func isTableArray(entries []tomlEntry, path []string) bool {
+	for _, entry := range entries {
+		if entry.header && entry.array && len(entry.path) == len(path)+1 && hasPathPrefix(entry.path, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func allMaps(items []interface{}) bool {
+	for _, item := range items {
+		if _, ok := toStringMap(item); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setTables sets the array of tables at path to items table by table, so that the tables
+// keep their layout and comments. Tables are added after the last one, or removed from
+// the end.
+func (e *tomlEditor) setTables(path []string, items []interface{}) error {
+	for index, item := range items {
+		itemPath := append(path[:len(path):len(path)], strconv.Itoa(index))
+		if !isTableArray(e.scan(), path) || !e.hasTable(itemPath) {
+			e.appendTable(path)
+		}
+
+		m, _ := toStringMap(item)
+		if err := e.setTable(itemPath, m); err != nil {
+			return err
+		}
+	}
+
+	for index := e.countTables(path) - 1; index >= len(items); index-- {
+		if err := e.delete(append(path[:len(path):len(path)], strconv.Itoa(index))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setTable sets the keys of the table at path to those of m, removing the others.
+func (e *tomlEditor) setTable(path []string, m map[string]interface{}) error {
+	removed := make(map[string][]string)
+
+	for _, entry := range e.scan() {
+		if len(entry.path) > len(path) && hasPathPrefix(entry.path, path) {
+			if _, ok := lookupFold(m, entry.path[len(path)]); !ok {
+				removed[strings.ToLower(entry.path[len(path)])] = entry.path[:len(path)+1]
+			}
+		}
+	}
+
+	for _, keyPath := range removed {
+		if err := e.delete(keyPath); err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := append(path[:len(path):len(path)], key)
+
+		// Sub-tables are set key by key too, rather than rewritten inline.
+		if child, ok := toStringMap(m[key]); ok && e.hasTable(keyPath) {
+			if err := e.setTable(keyPath, child); err != nil {
+				return err
+			}
+		} else if err := e.set(keyPath, m[key]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *tomlEditor) hasTable(path []string) bool {
+	for _, entry := range e.scan() {
+		if entry.header && len(entry.path) == len(path) && hasPathPrefix(entry.path, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// countTables returns the number of tables of the array of tables at path.
+func (e *tomlEditor) countTables(path []string) int {
+	count := 0
+
+	for _, entry := range e.scan() {
+		if entry.header && entry.array && len(entry.path) == len(path)+1 && hasPathPrefix(entry.path, path) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// appendTable adds an empty table after the last one of the array of tables at path,
+// with the header of the others.
+func (e *tomlEditor) appendTable(path []string) {
+	header, at := "", len(e.lines)
+
+	for _, entry := range e.scan() {
+		if !hasPathPrefix(entry.path, path) || len(entry.path) <= len(path) {
+			continue
+		}
+
+		if entry.header && entry.array && len(entry.path) == len(path)+1 {
+			line := strings.TrimSpace(e.lines[entry.start])
+			header = line[:strings.LastIndex(line, "]]")+2]
+		}
+
+		at = entry.end
+	}
+
+	lines := []string{header}
+	if at > 0 && strings.TrimSpace(e.lines[at-1]) != "" {
+		lines = []string{"", header}
+	}
+
+	e.lines = append(e.lines[:at], append(lines, e.lines[at:]...)...)
+}
+
+func setInlineValue(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	switch v := node.(type) {
+	case []interface{}:
+		index, ok := arrayIndex(path[0], len(v))
+		if index == len(v) {
+			v, ok = append(v, nil), true
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrIndexOutOfRange, path[0])
+		}
+
+		child, err := setInlineValue(v[index], path[1:], value)
+		v[index] = child
+
+		return v, err
+	case map[string]interface{}:
+		key := path[0]
+		for k := range v {
+			if strings.EqualFold(k, key) {
+				key = k
+			}
+		}
+
+		child, err := setInlineValue(v[key], path[1:], value)
+		v[key] = child
+
+		return v, err
+	default:
+		return setInlineValue(make(map[string]interface{}), path, value)
+	}
+}
+
+// delete removes the key/values and the tables at or under path.
+func (e *tomlEditor) delete(path []string) error {
+	removed := make([]bool, len(e.lines))
+
+	for _, entry := range e.scan() {
+		if hasPathPrefix(entry.path, path) {
+			for index := entry.start; index < entry.end; index++ {
+				removed[index] = true
+			}
+		}
+	}
+
+	lines := make([]string, 0, len(e.lines))
+
+	for index, line := range e.lines {
+		switch {
+		case removed[index]:
+		case index > 0 && removed[index-1] && strings.TrimSpace(line) == "" &&
+			(len(lines) == 0 || strings.TrimSpace(lines[len(lines)-1]) == ""):
+			// Removing a block between blank lines leaves one of them.
+		default:
+			lines = append(lines, line)
+		}
+	}
+
+	// Removing the last block leaves no blank line behind.
+	for len(lines) > 0 && removed[len(removed)-1] && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	e.lines = lines
+
+	return nil
+}
+
+func tomlKey(key string) string {
+	if bareKeyExp.MatchString(key) {
+		return key
+	}
+
+	return tomlString(key)
+}
+
+func tomlString(s string) string {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// tomlValue encodes value inline.
+func tomlValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return tomlString(v)
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v)
+	case float32:
+		return tomlValue(float64(v))
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "nan"
+		case math.IsInf(v, 1):
+			return "inf"
+		case math.IsInf(v, -1):
+			return "-inf"
+		}
+
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+
+		return s
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []interface{}:
+		items := make([]string, len(v))
+		for index, item := range v {
+			items[index] = tomlValue(item)
+		}
+
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return "{}"
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		pairs := make([]string, len(keys))
+		for index, key := range keys {
+			pairs[index] = tomlKey(key) + " = " + tomlValue(v[key])
+		}
+
+		return "{ " + strings.Join(pairs, ", ") + " }"
+	default:
+		if m, ok := toStringMap(value); ok {
+			return tomlValue(m)
+		}
+
+		return tomlString(fmt.Sprint(value))
+	}
+}
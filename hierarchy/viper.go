@@ -41,6 +41,11 @@ func GetUint(key string) uint {
 	return _default.GetUint(key)
 }
 
+// GetUint16 returns the value associated with the key as an unsigned integer.
+func GetUint16(key string) uint16 {
+	return _default.GetUint16(key)
+}
+
 // GetUint32 returns the value associated with the key as an unsigned integer.
 func GetUint32(key string) uint32 {
 	return _default.GetUint32(key)
@@ -147,11 +152,14 @@ func SetEnvPrefix(in string) {
 }
 
 // SetEnvKeyReplacer sets the environment variable key replacer.
+//
+// Deprecated: it only affects the embedded viper. LoadEnv, AutomaticEnv and BindEnv name
+// env vars after keys themselves, see LoadEnv.
 func SetEnvKeyReplacer(r *strings.Replacer) {
 	_default.SetEnvKeyReplacer(r)
 }
 
-// AutomaticEnv automatically binds all environment variables with the given prefix.
+// AutomaticEnv applies the environment variables with the given prefix.
 func AutomaticEnv() {
 	_default.AutomaticEnv()
 }
@@ -171,6 +179,21 @@ func BindEnv(input ...string) error {
 	return _default.BindEnv(input...)
 }
 
+// MustBindEnv binds a Viper key to an environment variable, panicking on error.
+func MustBindEnv(input ...string) {
+	_default.MustBindEnv(input...)
+}
+
+// BindFlagValue binds a key to a FlagValue.
+func BindFlagValue(key string, flag viper.FlagValue) error {
+	return _default.BindFlagValue(key, flag)
+}
+
+// BindFlagValues binds a Viper flag to a FlagValueSet.
+func BindFlagValues(flags viper.FlagValueSet) error {
+	return _default.BindFlagValues(flags)
+}
+
 // BindEnvWithPrefix binds a Viper key to an environment variable with a prefix.
 func BindEnvWithPrefix(prefix, key string) error {
 	return _default.BindEnv(prefix + key)
@@ -181,6 +204,21 @@ func Unmarshal(rawVal interface{}, opts ...viper.DecoderConfigOption) error {
 	return _default.Unmarshal(rawVal, opts...)
 }
 
+// UnmarshalExact unmarshals the config into a struct, failing on unknown keys.
+func UnmarshalExact(rawVal interface{}, opts ...viper.DecoderConfigOption) error {
+	return _default.UnmarshalExact(rawVal, opts...)
+}
+
+// InConfig checks to see if the given key (or an alias) is in the config file.
+func InConfig(key string) bool {
+	return _default.InConfig(key)
+}
+
+// Debug prints the sources of the hierarchy.
+func Debug() {
+	_default.Debug()
+}
+
 // UnmarshalKey unmarshals a single key from the config into a struct.
 func UnmarshalKey(key string, rawVal interface{}, opts ...viper.DecoderConfigOption) error {
 	return _default.UnmarshalKey(key, rawVal, opts...)
@@ -191,12 +229,12 @@ func AddConfigPath(in string) {
 	_default.AddConfigPath(in)
 }
 
-// ReadInConfig reads in a config file.
+// ReadInConfig reads in a config file and merges it into the hierarchy.
 func ReadInConfig() error {
 	return _default.ReadInConfig()
 }
 
-// ReadConfig reads in a config file.
+// ReadConfig reads in a config and merges it into the hierarchy.
 func ReadConfig(in io.Reader) error {
 	return _default.ReadConfig(in)
 }
@@ -232,6 +270,9 @@ func SafeWriteConfigAs(filename string) error {
 }
 
 // ReadRemoteConfig reads a config from a remote source.
+//
+// Deprecated: it fails with ErrRemoteConfig. Fetch the config and load it with
+// LoadAssetMap instead.
 func ReadRemoteConfig() error {
 	return _default.ReadRemoteConfig()
 }
@@ -252,16 +293,22 @@ func SetFs(fs afero.Fs) {
 }
 
 // AddRemoteProvider adds a remote provider to viper.
+//
+// Deprecated: remote configs are only read by ReadRemoteConfig, see ReadRemoteConfig.
 func AddRemoteProvider(provider, endpoint, path string) error {
 	return _default.AddRemoteProvider(provider, endpoint, path)
 }
 
 // AddSecureRemoteProvider adds a secure remote provider to viper.
+//
+// Deprecated: remote configs are only read by ReadRemoteConfig, see ReadRemoteConfig.
 func AddSecureRemoteProvider(provider, endpoint, path, secret string) error {
 	return _default.AddSecureRemoteProvider(provider, endpoint, path, secret)
 }
 
-// WatchRemoteCOnfigOnChannel watches a remote config and returns a channel to which all.
+// WatchRemoteConfigOnChannel watches a remote config.
+//
+// Deprecated: it fails with ErrRemoteConfig, see ReadRemoteConfig.
 func WatchRemoteConfigOnChannel() error {
 	return _default.WatchRemoteConfigOnChannel()
 }
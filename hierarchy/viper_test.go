@@ -0,0 +1,262 @@
+package hierarchy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func TestReadConfigPrecedence(t *testing.T) {
+	t.Setenv("LIBRATEST_LEVEL", "warn")
+
+	h := New()
+	h.SetDefault("level", "debug")
+	h.SetConfigType("yaml")
+
+	var notified interface{}
+	h.Subscribe("level", func(_, current interface{}) {
+		notified = current
+	})
+
+	if err := h.ReadConfig(strings.NewReader("level: info\nname: api\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := h.GetString("level"); got != "info" || notified != "info" {
+		t.Errorf("level = %q, notified %v, want info from the config", got, notified)
+	}
+
+	if err := h.LoadEnv("LIBRATEST"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := h.GetString("level"); got != "warn" {
+		t.Errorf("level = %q, want warn from the env var over the config", got)
+	}
+
+	if err := h.MergeConfig(strings.NewReader("level: error\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := h.GetString("level"); got != "warn" {
+		t.Errorf("level = %q after MergeConfig, want the env var to still win", got)
+	}
+
+	if got := h.GetString("name"); got != "api" {
+		t.Errorf("name = %q, want api kept by MergeConfig", got)
+	}
+}
+
+func TestReadInConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(file, []byte("level: info\nhooks: {file: true}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h := New()
+	h.SetConfigFile(file)
+
+	if err := h.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	if origins := h.Explain("level").Origins; len(origins) != 1 || origins[0].Kind != SourceAsset || origins[0].Name != file {
+		t.Errorf("level origins = %v, want the config file", origins)
+	}
+
+	if err := os.WriteFile(file, []byte("level: warn\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := h.GetString("level"); got != "warn" {
+		t.Errorf("level = %q after reading again, want warn", got)
+	}
+
+	if h.IsSet("hooks.file") {
+		t.Errorf("hooks.file removed from the file is still set: %v", h.AllKeys())
+	}
+}
+
+func TestBindPFlag(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Int("port", 80, "")
+	flags.Bool("debug", false, "")
+	flags.StringSlice("tags", nil, "")
+
+	if err := flags.Parse([]string{"--debug", "--tags=a,b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := New()
+	if err := h.BindPFlags(flags); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := h.Get("port"); got != 80 {
+		t.Errorf("port = %#v, want the flag default 80", got)
+	}
+
+	if err := h.MergeConfigMap(map[string]interface{}{"port": 8080, "debug": false}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := h.Get("port"); got != 8080 {
+		t.Errorf("port = %#v, want 8080 from the config over the flag default", got)
+	}
+
+	if got := h.Get("debug"); got != true {
+		t.Errorf("debug = %#v, want the given flag over the config", got)
+	}
+
+	if got := h.GetStringSlice("tags"); len(got) != 2 || got[1] != "b" {
+		t.Errorf("tags = %v, want [a b]", got)
+	}
+}
+
+func TestBindEnv(t *testing.T) {
+	t.Setenv("LIBRATEST_DB_HOST", "db.local")
+	t.Setenv("LIBRATEST_PORT", "5432")
+	t.Setenv("DATABASE_USER", "admin")
+
+	h := New()
+	h.Set("db.port", 0)
+	h.SetEnvPrefix("libratest")
+
+	if err := h.BindEnv("db.host"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.BindEnv("db.user", "MISSING_USER", "DATABASE_USER"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := h.GetString("db.host"); got != "db.local" {
+		t.Errorf("db.host = %q, want db.local", got)
+	}
+
+	h.AutomaticEnv()
+
+	if got := h.Get("port"); got != "5432" {
+		t.Errorf("port = %#v, want the env var under the prefix", got)
+	}
+
+	if err := h.LoadEnv(""); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := h.GetString("db.user"); got != "admin" {
+		t.Errorf("db.user = %q after LoadEnv, want the bound env var", got)
+	}
+}
+
+type testFlag struct {
+	name, typ, value string
+	changed          bool
+}
+
+func (f testFlag) HasChanged() bool    { return f.changed }
+func (f testFlag) Name() string        { return f.name }
+func (f testFlag) ValueString() string { return f.value }
+func (f testFlag) ValueType() string   { return f.typ }
+
+type testFlagSet []testFlag
+
+func (s testFlagSet) VisitAll(fn func(viper.FlagValue)) {
+	for _, flag := range s {
+		fn(flag)
+	}
+}
+
+func TestViperShadows(t *testing.T) {
+	h := New()
+	if err := h.LoadAssetMap(map[string][]byte{
+		"app.yaml": []byte("logger:\n  level: info\n  size: 512\nverbose: true\ndb:\n  password: hunter2\n"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var config struct {
+		Logger struct {
+			Level string
+			Size  uint16
+		}
+		Verbose bool
+		DB      struct{ Password string }
+	}
+	if err := h.UnmarshalExact(&config); err != nil || config.Logger.Size != 512 || config.Logger.Level != "info" {
+		t.Errorf("UnmarshalExact = %+v, %v", config, err)
+	}
+
+	var partial struct{ Verbose bool }
+	if err := h.UnmarshalExact(&partial); err == nil {
+		t.Error("UnmarshalExact into a struct missing keys error = nil")
+	}
+
+	if got := h.GetUint16("logger.size"); got != 512 {
+		t.Errorf("GetUint16(logger.size) = %d, want 512", got)
+	}
+
+	h.SetDefault("logger.format", "json")
+
+	if !h.InConfig("logger.level") || h.InConfig("logger.format") {
+		t.Errorf("InConfig = %v, %v, want only logger.level", h.InConfig("logger.level"), h.InConfig("logger.format"))
+	}
+
+	// Values set at an alias move to its key.
+	h.RegisterAlias("verbose", "logger.verbose")
+	h.RegisterAlias("loglevel", "logger.level")
+	h.RegisterAlias("logger.level", "loglevel")
+	h.Set("loglevel", "debug")
+
+	if got := h.GetString("logger.level"); got != "debug" || h.GetString("loglevel") != "debug" {
+		t.Errorf("logger.level = %q, loglevel = %q, want debug set through the alias", got, h.GetString("loglevel"))
+	}
+
+	if !h.GetBool("logger.verbose") || !h.IsSet("verbose") || !h.InConfig("verbose") {
+		t.Error("verbose was not moved to logger.verbose")
+	}
+
+	if err := h.BindFlagValues(testFlagSet{
+		testFlag{name: "workers", typ: "int", value: "4", changed: true},
+		testFlag{name: "hosts", typ: "stringSlice", value: "[a,b]"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := h.Get("workers"); got != 4 {
+		t.Errorf("workers = %#v, want 4", got)
+	}
+
+	if got := h.GetStringSlice("hosts"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("hosts = %v, want [a b]", got)
+	}
+
+	var debug strings.Builder
+	h.DebugTo(&debug)
+
+	if s := debug.String(); strings.Contains(s, "hunter2") || !strings.Contains(s, "debug") {
+		t.Errorf("DebugTo =\n%s\nwant the layers with the password redacted", s)
+	}
+
+	if err := h.ReadRemoteConfig(); !errors.Is(err, ErrRemoteConfig) {
+		t.Errorf("ReadRemoteConfig error = %v, want %v", err, ErrRemoteConfig)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("MustBindEnv without a key did not panic")
+		}
+	}()
+
+	h.MustBindEnv()
+}
@@ -0,0 +1,533 @@
+package hierarchy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// assetEditor edits an asset in place, keeping what it can of its layout.
+type assetEditor interface {
+	set(path []string, value interface{}) error
+	delete(path []string) error
+	bytes() ([]byte, error)
+}
+
+func newAssetEditor(name string, data []byte) (assetEditor, error) {
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".yaml", ".yml":
+		return newYAMLEditor(data, false)
+	case ".json":
+		return newYAMLEditor(data, true)
+	case ".toml":
+		return newTOMLEditor(data), nil
+	case "":
+		return nil, fmt.Errorf("%w: missing extension", viper.UnsupportedConfigError(name))
+	default:
+		return nil, viper.UnsupportedConfigError(ext[1:])
+	}
+}
+
+// edit is a leaf value set, or deleted with a tombstone, by Set or Delete.
+type edit struct {
+	path  []string
+	value interface{}
+}
+
+// edits returns the edits made with Set and Delete under the prefix of h, with the
+// case of the keys restored.
+func (h *Hierarchy) edits() []edit {
+	l := h.base().current.Load()
+	prefix := splitKey(h.prefix)
+
+	override, _ := lookupPath(l.override, prefix)
+	m, _ := restoreCase(l.cases, strings.Join(prefix, "."), override).(map[string]interface{})
+
+	return collectEdits(nil, m, nil)
+}
+
+func collectEdits(path []string, m map[string]interface{}, edits []edit) []edit {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		childPath := append(path[:len(path):len(path)], key)
+		if child, ok := m[key].(map[string]interface{}); ok && len(child) > 0 {
+			edits = collectEdits(childPath, child, edits)
+		} else {
+			edits = append(edits, edit{path: childPath, value: m[key]})
+		}
+	}
+
+	return edits
+}
+
+func Rewrite(name string, data []byte) ([]byte, error) {
+	return _default.Rewrite(name, data)
+}
+
+// Rewrite applies the values set and deleted with Set and Delete to data, the content of
+// the asset name, and returns it in the same format, YAML, JSON or TOML. Comments, key
+// order and YAML anchors are kept where the edits allow it. Editing through an alias edits
+// a copy, while replacing an anchored value changes its aliases too.
+func (h *Hierarchy) Rewrite(name string, data []byte) ([]byte, error) {
+	editor, err := newAssetEditor(name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range h.edits() {
+		if isTombstone(e.value) {
+			err = editor.delete(e.path)
+		} else {
+			err = editor.set(e.path, exportValue(e.value))
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", name, strings.Join(e.path, "."), err)
+		}
+	}
+
+	return editor.bytes()
+}
+
+// WriteConfig writes the settings to the config file used by viper, see WriteConfigAs.
+func (h *Hierarchy) WriteConfig() error {
+	filename := h.ConfigFileUsed()
+	if filename == "" {
+		return h.Viper.WriteConfig()
+	}
+
+	return h.WriteConfigAs(filename)
+}
+
+// WriteConfigAs writes every setting to filename in the format of its extension, see
+// Export. To apply the edits made by Set and Delete to a file, keeping its comments, see
+// Rewrite.
+func (h *Hierarchy) WriteConfigAs(filename string) error {
+	data, err := h.Export(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, data, 0o644)
+}
+
+// SafeWriteConfig writes the settings to the config file used by viper, unless it exists.
+func (h *Hierarchy) SafeWriteConfig() error {
+	filename := h.ConfigFileUsed()
+	if filename == "" {
+		return h.Viper.SafeWriteConfig()
+	}
+
+	return h.SafeWriteConfigAs(filename)
+}
+
+// SafeWriteConfigAs writes every setting to filename, unless it exists.
+func (h *Hierarchy) SafeWriteConfigAs(filename string) error {
+	if _, err := os.Stat(filename); err == nil {
+		return viper.ConfigFileAlreadyExistsError(filename)
+	}
+
+	return h.WriteConfigAs(filename)
+}
+
+// exportValue converts the values with no counterpart in config formats into strings
+// that decode back to them.
+func exportValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Duration:
+		return v.String()
+	case ByteSize:
+		return v.String()
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			m[key] = exportValue(child)
+		}
+
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for index, child := range v {
+			items[index] = exportValue(child)
+		}
+
+		return items
+	default:
+		return value
+	}
+}
+
+// yamlEditor edits YAML, or JSON which is parsed as YAML, through its node tree.
+type yamlEditor struct {
+	doc    yaml.Node
+	json   bool
+	indent string
+	// anchors holds copies of the anchored nodes as loaded, which aliases edited
+	// through are expanded to, whatever the edits made to the anchors.
+	anchors map[*yaml.Node]*yaml.Node
+}
+
+func newYAMLEditor(data []byte, isJSON bool) (*yamlEditor, error) {
+	e := &yamlEditor{json: isJSON, indent: detectIndent(data)}
+	if err := yaml.Unmarshal(data, &e.doc); err != nil {
+		return nil, err
+	}
+
+	if e.doc.Kind == 0 {
+		e.doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+
+	if e.doc.Content[0].Kind != yaml.MappingNode {
+		return nil, ErrHierachyShouldBeMap
+	}
+
+	e.anchors = make(map[*yaml.Node]*yaml.Node)
+	e.walk(&e.doc, func(node *yaml.Node) {
+		if node.Anchor != "" {
+			e.anchors[node] = copyYAML(node)
+		}
+	})
+
+	return e, nil
+}
+
+// walk calls fn with node and every node under it, except through aliases.
+func (e *yamlEditor) walk(node *yaml.Node, fn func(*yaml.Node)) {
+	fn(node)
+
+	for _, child := range node.Content {
+		e.walk(child, fn)
+	}
+}
+
+// detectIndent returns the indentation of the first indented line, or "" if there is none.
+func detectIndent(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && trimmed != line && !strings.HasPrefix(trimmed, "#") {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+
+	return ""
+}
+
+func (e *yamlEditor) set(path []string, value interface{}) error {
+	return e.edit(e.doc.Content[0], path, value)
+}
+
+func (e *yamlEditor) delete(path []string) error {
+	return e.edit(e.doc.Content[0], path, tombstone{})
+}
+
+func (e *yamlEditor) bytes() ([]byte, error) {
+	var buf bytes.Buffer
+
+	if e.json {
+		if err := writeJSONNode(&buf, e.doc.Content[0], e.indent, ""); err != nil {
+			return nil, err
+		}
+
+		buf.WriteByte('\n')
+
+		return buf.Bytes(), nil
+	}
+
+	indent := len(e.indent)
+	if indent == 0 || strings.Contains(e.indent, "\t") {
+		indent = 2
+	}
+
+	// Merge keys decode with an explicit tag, which the encoder would print.
+	e.walk(&e.doc, func(node *yaml.Node) {
+		if node.Kind == yaml.ScalarNode && node.Tag == "!!merge" {
+			node.Tag = ""
+		}
+	})
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(indent)
+
+	if err := encoder.Encode(&e.doc); err != nil {
+		return nil, err
+	}
+
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// edit sets value, or deletes if it is a tombstone, at path under node.
+func (e *yamlEditor) edit(node *yaml.Node, path []string, value interface{}) error {
+	last := len(path) == 1
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		index := -1
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if strings.EqualFold(node.Content[i].Value, path[0]) {
+				index = i
+			}
+		}
+
+		switch {
+		case index >= 0 && last && isTombstone(value):
+			node.Content = append(node.Content[:index], node.Content[index+2:]...)
+
+			return nil
+		case index < 0 && isTombstone(value):
+			return nil
+		case index < 0:
+			// A key missing here may be merged in with `<<`; setting it here overrides it.
+			key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: path[0]}
+			node.Content = append(node.Content, key, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+			index = len(node.Content) - 2
+		}
+
+		return e.editChild(&node.Content[index+1], path, value)
+	case yaml.SequenceNode:
+		index, ok := arrayIndex(path[0], len(node.Content))
+		appending := index == len(node.Content)
+
+		if !ok && !appending {
+			return fmt.Errorf("%w: %s", ErrIndexOutOfRange, path[0])
+		}
+
+		switch {
+		case last && isTombstone(value):
+			if !appending {
+				node.Content = append(node.Content[:index], node.Content[index+1:]...)
+			}
+
+			return nil
+		case appending:
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+		}
+
+		return e.editChild(&node.Content[index], path, value)
+	default:
+		if isTombstone(value) {
+			return nil
+		}
+
+		// A scalar in the way becomes a mapping, as it does with Set.
+		*node = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", HeadComment: node.HeadComment, LineComment: node.LineComment}
+
+		return e.edit(node, path, value)
+	}
+}
+
+// editChild edits the node in slot, reached by the first segment of path.
+func (e *yamlEditor) editChild(slot **yaml.Node, path []string, value interface{}) error {
+	if len(path) == 1 {
+		return syncYAML(slot, value)
+	}
+
+	if child := *slot; child.Kind == yaml.AliasNode {
+		// Editing through an alias edits a copy, leaving the anchor and other aliases alone.
+		anchored, ok := e.anchors[child.Alias]
+		if !ok {
+			anchored = child.Alias
+		}
+
+		copied := copyYAML(anchored)
+		copied.Anchor = ""
+		copied.HeadComment, copied.LineComment = child.HeadComment, child.LineComment
+		*slot = copied
+	}
+
+	return e.edit(*slot, path[1:], value)
+}
+
+// syncYAML makes the node in slot hold value, keeping the nodes, and so the comments,
+// of the parts that already match.
+func syncYAML(slot **yaml.Node, value interface{}) error {
+	old := *slot
+
+	switch v := value.(type) {
+	case []interface{}:
+		if old.Kind == yaml.SequenceNode {
+			if len(old.Content) > len(v) {
+				old.Content = old.Content[:len(v)]
+			}
+
+			for index, item := range v {
+				if index == len(old.Content) {
+					old.Content = append(old.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"})
+				}
+
+				if err := syncYAML(&old.Content[index], item); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+	case map[string]interface{}:
+		if old.Kind == yaml.MappingNode {
+			return syncYAMLMapping(old, v)
+		}
+	default:
+		var current interface{}
+		if old.Kind == yaml.ScalarNode && old.Decode(&current) == nil && reflect.DeepEqual(current, value) {
+			return nil
+		}
+	}
+
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return err
+	}
+
+	node.HeadComment, node.LineComment, node.FootComment = old.HeadComment, old.LineComment, old.FootComment
+	if old.Kind == yaml.ScalarNode && node.Tag == "!!str" && old.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) != 0 {
+		node.Style = old.Style
+	}
+
+	if old.Anchor != "" {
+		node.Anchor = old.Anchor
+		*old = node
+
+		return nil
+	}
+
+	*slot = &node
+
+	return nil
+}
+
+func syncYAMLMapping(node *yaml.Node, m map[string]interface{}) error {
+	content := make([]*yaml.Node, 0, len(node.Content))
+	seen := make(map[string]bool, len(m))
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+
+		for name, child := range m {
+			if strings.EqualFold(name, key.Value) {
+				if err := syncYAML(&node.Content[i+1], child); err != nil {
+					return err
+				}
+
+				seen[name] = true
+				content = append(content, key, node.Content[i+1])
+
+				break
+			}
+		}
+	}
+
+	names := make([]string, 0, len(m))
+	for name := range m {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		var child yaml.Node
+		if err := child.Encode(m[name]); err != nil {
+			return err
+		}
+
+		content = append(content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, &child)
+	}
+
+	node.Content = content
+
+	return nil
+}
+
+func copyYAML(node *yaml.Node) *yaml.Node {
+	copied := *node
+	copied.Content = make([]*yaml.Node, len(node.Content))
+
+	for index, child := range node.Content {
+		copied.Content[index] = copyYAML(child)
+	}
+
+	return &copied
+}
+
+// writeJSONNode writes node as JSON in the order of its keys, indenting nested values by
+// indent, or on one line if indent is empty.
+func writeJSONNode(buf *bytes.Buffer, node *yaml.Node, indent, prefix string) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	opening, closing, step := "{", "}", 2
+	if node.Kind == yaml.SequenceNode {
+		opening, closing, step = "[", "]", 1
+	}
+
+	if node.Kind != yaml.MappingNode && node.Kind != yaml.SequenceNode {
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		buf.Write(data)
+
+		return nil
+	}
+
+	buf.WriteString(opening)
+
+	for index := 0; index < len(node.Content); index += step {
+		if index > 0 {
+			buf.WriteByte(',')
+		}
+
+		if indent != "" {
+			buf.WriteString("\n" + prefix + indent)
+		}
+
+		if step == 2 {
+			key, _ := json.Marshal(node.Content[index].Value)
+			buf.Write(key)
+			buf.WriteString(":")
+
+			if indent != "" {
+				buf.WriteString(" ")
+			}
+		}
+
+		if err := writeJSONNode(buf, node.Content[index+step-1], indent, prefix+indent); err != nil {
+			return err
+		}
+	}
+
+	if indent != "" && len(node.Content) > 0 {
+		buf.WriteString("\n" + prefix)
+	}
+
+	buf.WriteString(closing)
+
+	return nil
+}
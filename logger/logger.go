@@ -24,15 +24,19 @@ func New(h *hierarchy.Hierarchy) (*logrus.Logger, error) {
 	logger.SetFormatter(formatter)
 
 	// Set hooks.
-	h.ForeachInArray("hooks", func(index int, h *hierarchy.Hierarchy) (bool, error) {
-		typ := h.GetString("type")
-		hook, err := NewHook(typ, h)
-		if err != nil {
-			return false, err
+	if h.IsSet("hooks") {
+		if err := h.ForeachInArray("hooks", func(index int, h *hierarchy.Hierarchy) (bool, error) {
+			typ := h.GetString("type")
+			hook, err := NewHook(typ, h)
+			if err != nil {
+				return false, err
+			}
+			logger.AddHook(hook)
+			return true, nil
+		}); err != nil {
+			return nil, err
 		}
-		logger.AddHook(hook)
-		return true, nil
-	})
+	}
 
 	// Set Level
 	logger.SetLevel(NewLogLevel(h.GetStringVal("level", "info")).ToLogrus())